@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Environments written to src/utils/constants.js
+const (
+	envProd    = "PROD"
+	envStaging = "STAGING"
+	envDev     = "DEV"
+)
+
+// ciRefVars are the CI variables that name the branch or tag being built, checked in order.
+// Each entry only applies when its detect variable is set, so stray local variables are ignored.
+var ciRefVars = []struct {
+	system string
+	detect string
+	name   string
+	isTag  bool
+}{
+	{"GitLab CI", "GITLAB_CI", "CI_COMMIT_TAG", true},
+	{"GitLab CI", "GITLAB_CI", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", false},
+	{"GitLab CI", "GITLAB_CI", "CI_COMMIT_BRANCH", false},
+	{"GitLab CI", "GITLAB_CI", "CI_COMMIT_REF_NAME", false},
+	{"Bitbucket Pipelines", "BITBUCKET_BUILD_NUMBER", "BITBUCKET_TAG", true},
+	{"Bitbucket Pipelines", "BITBUCKET_BUILD_NUMBER", "BITBUCKET_BRANCH", false},
+	{"CircleCI", "CIRCLECI", "CIRCLE_TAG", true},
+	{"CircleCI", "CIRCLECI", "CIRCLE_BRANCH", false},
+	{"Buildkite", "BUILDKITE", "BUILDKITE_TAG", true},
+	{"Buildkite", "BUILDKITE", "BUILDKITE_BRANCH", false},
+	{"Jenkins", "JENKINS_URL", "TAG_NAME", true},
+	{"Jenkins", "JENKINS_URL", "BRANCH_NAME", false},
+}
+
+// BranchResolution is the branch the build environment is chosen from, and how it was found
+type BranchResolution struct {
+	Branch      string
+	Source      string
+	Environment string
+}
+
+// environmentForBranch maps a branch to the app environment
+func environmentForBranch(branch string) string {
+	switch branch {
+	case "main":
+		return envProd
+	case "staging":
+		return envStaging
+	default:
+		return envDev
+	}
+}
+
+// ciRef returns the branch or tag named by the CI environment, if running on a known CI
+func ciRef() (name string, isTag bool, source string) {
+	if os.Getenv("GITHUB_ACTIONS") != "" {
+		if head := os.Getenv("GITHUB_HEAD_REF"); head != "" {
+			return head, false, "GITHUB_HEAD_REF" // Pull requests: GITHUB_REF_NAME is "<n>/merge"
+		}
+		if name := os.Getenv("GITHUB_REF_NAME"); name != "" {
+			return name, os.Getenv("GITHUB_REF_TYPE") == "tag", "GITHUB_REF_NAME"
+		}
+	}
+	for _, v := range ciRefVars {
+		if os.Getenv(v.detect) == "" {
+			continue
+		}
+		if name := os.Getenv(v.name); name != "" {
+			return name, v.isTag, v.name
+		}
+	}
+	return "", false, ""
+}
+
+// gitOutput runs a git command in rootPath and returns its trimmed output
+func gitOutput(rootPath string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = rootPath
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// gitRefExists reports whether a fully qualified ref (refs/tags/x, refs/heads/x) exists
+func gitRefExists(rootPath, ref string) bool {
+	_, err := gitOutput(rootPath, "show-ref", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+// gitBranchNames lists the branches (local and origin, by short name) git branch -a
+// reports for the given filter, e.g. --contains <commit>
+func gitBranchNames(rootPath string, filter ...string) ([]string, error) {
+	args := append([]string{"branch", "-a", "--format=%(refname:short)"}, filter...)
+	output, err := gitOutput(rootPath, args...)
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, line := range strings.Split(output, "\n") {
+		name := refBranchName(strings.TrimSpace(line))
+		if name != "" && name != "HEAD" && !strings.HasPrefix(name, "(") && !slices.Contains(branches, name) {
+			branches = append(branches, name)
+		}
+	}
+	return branches, nil
+}
+
+// branchContaining picks the branch (local or origin) that contains commit. When several
+// do, the one whose tip is the commit wins; otherwise it fails rather than guess, since
+// the branch decides the app environment. It also fails when no branch contains the
+// commit (e.g. a shallow CI clone).
+func branchContaining(rootPath, commit string) (string, error) {
+	sha, err := gitOutput(rootPath, "rev-parse", "--verify", commit+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown commit %s: %w", commit, err)
+	}
+	branches, err := gitBranchNames(rootPath, "--contains", sha)
+	if err != nil {
+		return "", err
+	}
+	switch len(branches) {
+	case 0:
+		return "", fmt.Errorf("no branch contains commit %.7s", sha)
+	case 1:
+		return branches[0], nil
+	}
+	tips, err := gitBranchNames(rootPath, "--points-at", sha)
+	if err != nil {
+		return "", err
+	}
+	if len(tips) == 1 {
+		return tips[0], nil
+	}
+	if len(tips) > 1 {
+		branches = tips
+	}
+	return "", fmt.Errorf("commit %.7s is on several branches (%s)", sha, strings.Join(branches, ", "))
+}
+
+// branchForTag resolves a tag to the branch it was cut from
+func branchForTag(rootPath, tag string) (string, error) {
+	branch, err := branchContaining(rootPath, "refs/tags/"+tag)
+	if err != nil {
+		return "", fmt.Errorf("cannot tell which branch tag %s belongs to (%v); set branch in the config, pass -branch or set the CI branch variable", tag, err)
+	}
+	return branch, nil
+}
+
+// resolveBuildBranch decides which branch the build counts as, in order: the branch
+// override, the ref being built, the CI environment, the checked-out branch, and for a
+// detached HEAD a tag pointing at it or the branch containing it. It never falls back
+// silently: if none of these work the build fails.
+func resolveBuildBranch(config Config) (*BranchResolution, error) {
+	res, err := resolveBranchName(config)
+	if err != nil {
+		return nil, err
+	}
+	res.Environment = environmentForBranch(res.Branch)
+	return res, nil
+}
+
+// resolveBranchName applies the resolution order documented on resolveBuildBranch
+func resolveBranchName(config Config) (*BranchResolution, error) {
+	root := config.RootPath
+	if config.Branch != "" {
+		return &BranchResolution{Branch: config.Branch, Source: "branch override"}, nil
+	}
+
+	if ref := config.Ref; ref != "" {
+		name := refBranchName(ref)
+		switch {
+		case gitRefExists(root, "refs/heads/"+name) || gitRefExists(root, "refs/remotes/origin/"+name):
+			return &BranchResolution{Branch: name, Source: "ref " + ref}, nil
+		case gitRefExists(root, "refs/tags/"+ref):
+			branch, err := branchForTag(root, ref)
+			if err != nil {
+				return nil, err
+			}
+			return &BranchResolution{Branch: branch, Source: fmt.Sprintf("tag %s on %s", ref, branch)}, nil
+		}
+		// A commit SHA: the worktree HEAD is detached at it, handled below
+	}
+
+	if name, isTag, source := ciRef(); name != "" {
+		if !isTag {
+			return &BranchResolution{Branch: name, Source: source}, nil
+		}
+		branch, err := branchForTag(root, name)
+		if err != nil {
+			return nil, err
+		}
+		return &BranchResolution{Branch: branch, Source: fmt.Sprintf("%s tag %s on %s", source, name, branch)}, nil
+	}
+
+	branch, err := getCurrentGitBranch(root)
+	if err != nil {
+		return nil, err
+	}
+	if branch != "HEAD" && branch != "" {
+		return &BranchResolution{Branch: branch, Source: "checked-out branch"}, nil
+	}
+
+	// Detached HEAD: a release tag on this commit, or the branch that contains it
+	if tags, err := gitOutput(root, "tag", "--points-at", "HEAD"); err == nil && tags != "" {
+		tag := strings.Split(tags, "\n")[0]
+		branch, err := branchForTag(root, tag)
+		if err != nil {
+			return nil, err
+		}
+		return &BranchResolution{Branch: branch, Source: fmt.Sprintf("detached HEAD at tag %s on %s", tag, branch)}, nil
+	}
+	branch, err = branchContaining(root, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("detached HEAD: %v; set branch in the config, pass -branch or set the CI branch variable", err)
+	}
+	return &BranchResolution{Branch: branch, Source: "detached HEAD contained in " + branch}, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// clearCIEnv unsets the variables ciRef reads, so the tests behave the same on CI
+func clearCIEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"GITHUB_ACTIONS", "GITHUB_HEAD_REF", "GITHUB_REF_NAME", "GITHUB_REF_TYPE"} {
+		t.Setenv(name, "")
+	}
+	for _, v := range ciRefVars {
+		t.Setenv(v.detect, "")
+		t.Setenv(v.name, "")
+	}
+}
+
+func TestResolveBuildBranch(t *testing.T) {
+	// c0 - c1 (main, tag v1.0) - c2 (staging) - c3 (feature)
+	repo := t.TempDir()
+	gitRun(t, repo, "init", "-q", "-b", "main")
+	commit := func(msg string) string {
+		gitRun(t, repo, "commit", "-q", "--allow-empty", "-m", msg)
+		return strings.TrimSpace(gitRun(t, repo, "rev-parse", "HEAD"))
+	}
+	c0 := commit("c0")
+	commit("c1")
+	gitRun(t, repo, "tag", "v1.0")
+	gitRun(t, repo, "checkout", "-q", "-b", "staging")
+	c2 := commit("c2")
+	gitRun(t, repo, "checkout", "-q", "-b", "feature")
+	c3 := commit("c3")
+
+	tests := []struct {
+		name     string
+		checkout string            // Branch, tag or commit to check out (detached unless a branch)
+		branch   string            // Config.Branch
+		ref      string            // Config.Ref
+		env      map[string]string // CI variables
+		want     string            // Resolved branch; empty means an error
+		wantErr  string
+	}{
+		{name: "override beats everything", checkout: "feature", branch: "hotfix", ref: "staging",
+			env: map[string]string{"GITLAB_CI": "true", "CI_COMMIT_BRANCH": "develop"}, want: "hotfix"},
+		{name: "ref branch beats CI", checkout: "feature", ref: "origin/staging",
+			env: map[string]string{"GITLAB_CI": "true", "CI_COMMIT_BRANCH": "develop"}, want: "staging"},
+		{name: "ref tag resolves to its branch tip", checkout: "feature", ref: "v1.0", want: "main"},
+		{name: "CI branch beats checkout", checkout: "feature",
+			env: map[string]string{"GITLAB_CI": "true", "CI_COMMIT_BRANCH": "develop"}, want: "develop"},
+		{name: "CI tag", checkout: "feature",
+			env: map[string]string{"GITLAB_CI": "true", "CI_COMMIT_TAG": "v1.0"}, want: "main"},
+		{name: "GitHub pull request", checkout: "feature",
+			env: map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_HEAD_REF": "fix-login", "GITHUB_REF_NAME": "12/merge"}, want: "fix-login"},
+		{name: "CI variables ignored off CI", checkout: "feature",
+			env: map[string]string{"CI_COMMIT_BRANCH": "develop"}, want: "feature"},
+		{name: "checked-out branch", checkout: "staging", want: "staging"},
+		{name: "detached at a tag", checkout: "v1.0", want: "main"},
+		{name: "ref SHA detached on one branch", checkout: c3, ref: c3, want: "feature"},
+		{name: "detached at a branch tip", checkout: c2, want: "staging"},
+		{name: "detached on several branches", checkout: c0, wantErr: "several branches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearCIEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if tt.checkout == "main" || tt.checkout == "staging" || tt.checkout == "feature" {
+				gitRun(t, repo, "checkout", "-q", tt.checkout)
+			} else {
+				gitRun(t, repo, "checkout", "-q", "--detach", tt.checkout)
+			}
+
+			res, err := resolveBuildBranch(Config{RootPath: repo, Branch: tt.branch, Ref: tt.ref})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Branch != tt.want {
+				t.Errorf("branch = %s (%s), want %s", res.Branch, res.Source, tt.want)
+			}
+			if res.Environment != environmentForBranch(tt.want) {
+				t.Errorf("environment = %s", res.Environment)
+			}
+		})
+	}
+}
@@ -11,36 +11,31 @@ import (
 	"strings"
 )
 
-func updateEnvironmentConstant(config Config, branch string, logOutput io.Writer) error {
+var environmentConstantRe = regexp.MustCompile(`const ENVIRONMENT = "[^"]*";`)
+
+// updateEnvironmentConstant sets ENVIRONMENT in src/utils/constants.js, failing if the
+// constant is missing rather than building with whatever value is committed
+func updateEnvironmentConstant(config Config, environment string, touched *fileSnapshot, logOutput io.Writer) error {
 	constantsFilePath := filepath.Join(config.RootPath, "src", "utils", "constants.js")
-	fmt.Fprintf(logOutput, "Updating environment constant in %s based on branch: %s\n", constantsFilePath, branch)
+	fmt.Fprintf(logOutput, "Updating environment constant in %s to %s\n", constantsFilePath, environment)
 
 	// Read the constants file
 	content, err := os.ReadFile(constantsFilePath)
 	if err != nil {
 		return fmt.Errorf("failed to read constants file: %w", err)
 	}
-
-	// Determine the environment based on the branch
-	var environment string
-	switch branch {
-	case "main":
-		environment = "PROD"
-	case "staging":
-		environment = "STAGING"
-	default:
-		environment = "DEV"
+	if !environmentConstantRe.Match(content) {
+		return fmt.Errorf("no `const ENVIRONMENT = \"...\";` declaration found in %s", constantsFilePath)
 	}
 
-	// Replace the ENVIRONMENT constant
-	updatedContent := strings.ReplaceAll(
-		string(content),
-		`const ENVIRONMENT = "DEV";`, // Default assumption, adjust if needed
-		fmt.Sprintf(`const ENVIRONMENT = "%s";`, environment),
-	)
+	// Replace the ENVIRONMENT constant, whatever it is currently set to
+	updatedContent := environmentConstantRe.ReplaceAll(content, []byte(fmt.Sprintf(`const ENVIRONMENT = "%s";`, environment)))
 
 	// Write the updated content back to the file
-	if err := os.WriteFile(constantsFilePath, []byte(updatedContent), 0644); err != nil {
+	if err := touched.Track(constantsFilePath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(constantsFilePath, updatedContent, 0644); err != nil {
 		return fmt.Errorf("failed to write updated constants file: %w", err)
 	}
 
@@ -48,36 +43,146 @@ func updateEnvironmentConstant(config Config, branch string, logOutput io.Writer
 	return nil
 }
 
-func runBuildProcess(config Config, logOutput io.Writer) error {
+// keepArtifact moves a built artifact out of the shared dist/ directory into the run
+// folder, so a later build cannot overwrite it, and returns its absolute path
+func keepArtifact(path, runDir string, logOutput io.Writer) (string, error) {
+	dest, err := filepath.Abs(filepath.Join(runDir, filepath.Base(path)))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the run folder: %w", err)
+	}
+	if err := moveFile(path, dest); err != nil {
+		return "", fmt.Errorf("failed to move %s into the run folder: %w", filepath.Base(path), err)
+	}
+	fmt.Fprintf(logOutput, "Moved %s to %s\n", filepath.Base(path), dest)
+	return dest, nil
+}
+
+// runBuildSteps performs the build itself, recording what it learns and produces in manifest.
+// Artifacts are moved into runDir.
+func runBuildSteps(config Config, logOutput io.Writer, manifest *RunManifest, runDir string) (err error) {
+	// Build a specific ref in a temporary worktree, leaving the developer's checkout alone
+	if config.Ref != "" {
+		setLogStep(logOutput, "worktree")
+		commit, err := resolveGitRef(config.RootPath, config.Ref, logOutput)
+		if err != nil {
+			return err
+		}
+		wt, err := createGitWorktree(config.RootPath, config.Ref, commit, logOutput)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			endLogStep(logOutput, err) // Before cleanup takes over as the current step
+			setLogStep(logOutput, "cleanup")
+			if err := wt.Remove(); err != nil {
+				fmt.Fprintf(logOutput, "Warning: %v\n", err)
+			} else {
+				fmt.Fprintf(logOutput, "Removed worktree %s\n", wt.Path)
+			}
+			setLogStep(logOutput, "")
+		}()
+		config.RootPath = wt.Path
+		manifest.Ref = config.Ref
+		if config.SkipDeps {
+			fmt.Fprintln(logOutput, "Ignoring skip_deps: a fresh worktree has no node_modules")
+			config.SkipDeps = false
+		}
+	}
+
+	// Check the working tree before any file is edited
+	setLogStep(logOutput, "git")
+	if err := checkWorkingTree(config, logOutput); err != nil {
+		return err
+	}
+
+	// Files edited in place are put back however the build ends
+	touched := newFileSnapshot()
+	defer func() {
+		endLogStep(logOutput, err) // Before restore takes over as the current step
+		setLogStep(logOutput, "restore")
+		if err := touched.Restore(logOutput); err != nil {
+			fmt.Fprintf(logOutput, "Warning: %v\n", err)
+		}
+		setLogStep(logOutput, "")
+	}()
+
+	// Resolve the version first; it may come from the project rather than the config
+	setLogStep(logOutput, "setup")
+	version, err := resolveBuildVersion(config, touched, logOutput)
+	if err != nil {
+		return err
+	}
+	config.BuildVersion = version
+	manifest.Version = version
 	fmt.Fprintf(logOutput, "Starting build process for version %s...\n", config.BuildVersion)
 
 	// Calculate build number (reuse existing function)
-	buildNumber, err := calculateBuildNumberSimple(config.BuildVersion)
+	buildNumber, err := calculateBuildNumber(config.BuildVersion, config.BuildNumberScheme)
 	if err != nil {
 		fmt.Fprintf(logOutput, "Error calculating build number: %v\n", err)
 		return fmt.Errorf("error calculating build number: %w", err)
 	}
 	fmt.Fprintf(logOutput, "Using Build Number: %d\n", buildNumber)
+	manifest.BuildNumber = buildNumber
 
-	// Check current branch (optional, reuse function)
-	currentBranch, err := getCurrentGitBranch(config.RootPath)
+	// Decide which branch (and so which environment) this build is for
+	setLogStep(logOutput, "branch")
+	resolution, err := resolveBuildBranch(config)
 	if err != nil {
-		fmt.Fprintf(logOutput, "Warning: could not determine git branch: %v\n", err)
-		currentBranch = "unknown"
+		return fmt.Errorf("error resolving branch: %w", err)
+	}
+	currentBranch := resolution.Branch
+	manifest.Branch = currentBranch
+	manifest.BranchSource = resolution.Source
+	manifest.Environment = resolution.Environment
+	if commit, err := getCurrentGitCommit(config.RootPath); err == nil {
+		manifest.Commit = commit
+	}
+	fmt.Fprintf(logOutput, "Git Branch: %s (from %s)\n", currentBranch, resolution.Source)
+	fmt.Fprintf(logOutput, "Environment: %s\n", resolution.Environment)
+
+	// Release notes: what changed since the last successful build of this branch
+	setLogStep(logOutput, "changelog")
+	since, sinceFrom := previousBuildCommit(config, manifest.RootPath, currentBranch, config.BuildVersion)
+	notes, err := collectReleaseNotes(config.RootPath, since, sinceFrom)
+	if err != nil {
+		fmt.Fprintf(logOutput, "Warning: no release notes: %v\n", err)
+	} else {
+		if since != "" {
+			fmt.Fprintf(logOutput, "Changes since %s:\n%s", sinceFrom, notes.Text())
+		} else {
+			fmt.Fprintf(logOutput, "No previous build found, listing recent changes:\n%s", notes.Text())
+		}
+		manifest.ReleaseNotes = notes
 	}
-	isMainBranch := currentBranch == "main"
-	fmt.Fprintf(logOutput, "Git Branch: %s (Is Main: %t)\n", currentBranch, isMainBranch)
 
 	// Update environment constant
-	if err := updateEnvironmentConstant(config, currentBranch, logOutput); err != nil {
+	setLogStep(logOutput, "env")
+	if err := updateEnvironmentConstant(config, resolution.Environment, touched, logOutput); err != nil {
 		return fmt.Errorf("error updating environment constant: %w", err)
 	}
 
-	// Install dependencies if not skipped
+	// Work out which platforms this machine will build
+	platforms, err := selectedPlatforms(config.Platform, logOutput)
+	if err != nil {
+		return err
+	}
+
+	projectType, reason, err := detectProjectType(config.RootPath, config.ProjectType)
+	if err != nil {
+		return fmt.Errorf("error detecting project type: %w", err)
+	}
+	fmt.Fprintf(logOutput, "Project type: %s (%s)\n", projectType, reason)
+	manifest.ProjectType = projectType
+
+	// Install JS dependencies if not skipped (prebuild needs node_modules)
+	if err := checkCancelled(logOutput); err != nil {
+		return err
+	}
+	setLogStep(logOutput, "deps")
 	if !config.SkipDeps {
 		fmt.Fprintf(logOutput, "Running dependency installation...\n")
-		// Pass logOutput to installDependencies if it needs logging
-		if err := installDependenciesGUI(config, logOutput); err != nil { // Assume modified installDependenciesGUI
+		if err := installDependenciesGUI(config, logOutput); err != nil {
 			return fmt.Errorf("error installing dependencies: %w", err)
 		}
 		fmt.Fprintf(logOutput, "Dependency installation finished.\n")
@@ -85,135 +190,108 @@ func runBuildProcess(config Config, logOutput io.Writer) error {
 		fmt.Fprintf(logOutput, "Skipping dependency installation.\n")
 	}
 
-	var androidArtifactPath string
-	var iosArtifactPath string
-	var buildErr error
-
-	// Process builds based on platform
-	platformLower := strings.ToLower(config.Platform)
-
-	if platformLower == "all" || platformLower == "android" {
-		// Assume buildAndroid is modified to accept logOutput io.Writer
-		androidArtifactPath, buildErr = buildAndroidGUI(config, buildNumber, isMainBranch, logOutput)
-		if buildErr != nil {
-			return fmt.Errorf("android build failed: %w", buildErr)
-		}
-	}
-
-	if platformLower == "all" || platformLower == "ios" {
-		if runtime.GOOS != "darwin" {
-			fmt.Fprintf(logOutput, "Skipping iOS build: requires macOS\n")
-		} else {
-			// Assume buildIOS is modified to accept logOutput io.Writer
-			iosArtifactPath, buildErr = buildIOSGUI(config, buildNumber, isMainBranch, logOutput)
-			if buildErr != nil {
-				return fmt.Errorf("ios build failed: %w", buildErr)
-			}
-		}
+	// Generate native projects before installing native dependencies into them
+	if err := checkCancelled(logOutput); err != nil {
+		return err
 	}
-
-	if platformLower != "all" && platformLower != "android" && platformLower != "ios" {
-		return fmt.Errorf("invalid platform specified: %s", config.Platform)
+	setLogStep(logOutput, "prebuild")
+	if err := runPrebuildPhase(config, projectType, platforms, logOutput); err != nil {
+		return err
 	}
 
-	// Handle uploads if not skipped
+	// Build each platform and upload its artifact as soon as it is ready; with several
+	// platforms the pipelines run in parallel
 	if !config.SkipUpload {
-		fmt.Fprintf(logOutput, "Handling uploads...\n")
-		if androidArtifactPath != "" {
-			if config.DriveFolderID == "" || config.GoogleCredentials == "" {
-				fmt.Fprintf(logOutput, "Skipping Google Drive upload: Drive Folder ID or Google Credentials Path not provided.\n")
-			} else {
-				// Assume uploadToGoogleDriveWithAPI is modified to accept logOutput
-				if err := uploadToGoogleDriveWithAPIGUI(config, androidArtifactPath, logOutput); err != nil {
-					return fmt.Errorf("google drive upload failed: %w", err)
-				}
-			}
-		}
-
-		if iosArtifactPath != "" && runtime.GOOS == "darwin" {
-			// Assume uploadToTestFlight is modified to accept logOutput
-			if err := uploadToTestFlightGUI(config, isMainBranch, iosArtifactPath, logOutput); err != nil {
-				return fmt.Errorf("test flight upload failed: %w", err)
-			}
-		}
+		fmt.Fprintf(logOutput, "Artifacts are uploaded as soon as each platform finishes.\n")
 	} else {
 		fmt.Fprintf(logOutput, "Skipping uploads.\n")
 	}
+	pb := &platformBuild{
+		config:      config,
+		buildNumber: buildNumber,
+		branch:      currentBranch,
+		notes:       notes,
+		touched:     touched,
+		manifest:    manifest,
+		artifactDir: runDir,
+	}
+	if err := runPlatformPipelines(pb, platforms, logOutput); err != nil {
+		return err
+	}
+	setLogStep(logOutput, "")
+
+	// Tag the release once everything it covers has been built and uploaded
+	if config.TagOnSuccess {
+		setLogStep(logOutput, "tag")
+		tag, created, err := createReleaseTag(config.RootPath, config.BuildVersion)
+		switch {
+		case err != nil:
+			fmt.Fprintf(logOutput, "Warning: %v\n", err)
+		case created:
+			fmt.Fprintf(logOutput, "Created tag %s (push it with 'git push origin %s')\n", tag, tag)
+		default:
+			fmt.Fprintf(logOutput, "Tag %s already points at this commit.\n", tag)
+		}
+	}
 
 	fmt.Fprintf(logOutput, "Build process seems complete.\n")
 	return nil // Success
 }
 
-// Modify installDependencies to accept logOutput
+// installDependenciesGUI installs JS dependencies, skipping the install when the
+// lockfile and node version are unchanged since the last install. CocoaPods are
+// installed separately (installPodsGUI) once prebuild has generated ios/.
 func installDependenciesGUI(config Config, logOutput io.Writer) error {
-	fmt.Fprintln(logOutput, "Installing npm dependencies...")
-	if err := runCmd(logOutput, true, config.RootPath, "npm", "install"); err != nil {
-		return fmt.Errorf("npm install failed: %w", err)
-	}
-
-	if runtime.GOOS == "darwin" {
-		fmt.Fprintln(logOutput, "Installing CocoaPods dependencies...")
-		iosDir := filepath.Join(config.RootPath, "ios")
-		// Basic check if dir exists
-		if _, err := os.Stat(iosDir); os.IsNotExist(err) {
-			fmt.Fprintln(logOutput, "Skipping pod install: 'ios' directory not found (run prebuild first?)")
-			return nil
-		}
-		// Add podfile check etc. if needed
+	cache := loadDepCache(config.RootPath, logOutput)
 
-		podCmd := "pod"
-		podArgs := []string{"install"}
-		// Add bundler check if desired
+	pm, err := detectPackageManager(config.RootPath, config.PackageManager)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(logOutput, "Using package manager: %s (%s)\n", pm.Name, pm.Reason)
 
-		if err := runCmd(logOutput, true, iosDir, podCmd, podArgs...); err != nil {
-			return fmt.Errorf("pod install failed: %w", err)
+	jsLockHash := "none"
+	if pm.Lockfile != "" {
+		jsLockHash = fileInput(filepath.Join(config.RootPath, pm.Lockfile))
+	}
+	jsInputs := map[string]string{
+		"package_manager": pm.Name,
+		"lockfile":        pm.Lockfile + ":" + jsLockHash,
+		"node":            cache.nodeVersion,
+	}
+	_, nodeModulesErr := os.Stat(filepath.Join(config.RootPath, "node_modules"))
+	if install, reason := cache.decide(depGroupJS, jsInputs, nodeModulesErr == nil, config.ForceReinstall); install {
+		fmt.Fprintf(logOutput, "Installing JS dependencies: %s\n", reason)
+		if err := installJSDependencies(config, pm, logOutput); err != nil {
+			return err
+		}
+		if err := cache.record(depGroupJS, jsInputs); err != nil {
+			fmt.Fprintf(logOutput, "Warning: %v\n", err)
 		}
+	} else {
+		fmt.Fprintf(logOutput, "Skipping JS dependency install: %s\n", reason)
 	}
 	return nil
 }
 
 // Modify buildAndroid to accept logOutput and use runCmd properly
-func buildAndroidGUI(config Config, buildNumber int, isMainBranch bool, logOutput io.Writer) (string, error) {
-	fmt.Fprintln(logOutput, "Building Android app using prebuild and Gradle...")
+func buildAndroidGUI(config Config, buildNumber int, isMainBranch bool, touched *fileSnapshot, logOutput io.Writer) (string, error) {
+	setLogStep(logOutput, "android")
+	fmt.Fprintln(logOutput, "Building Android app using Gradle...")
 	// --- Setup ---
 	if err := os.MkdirAll(androidOutput, 0755); err != nil {
 		return "", fmt.Errorf("failed to create output dir %s: %w", androidOutput, err)
 	}
 
-	// --- Prebuild ---
-	fmt.Fprintln(logOutput, "Running expo prebuild...")
-	expoCmd := "npx"
-	prebuildArgs := []string{"expo", "prebuild", "--platform", "android", "--no-install"}
-	if err := runCmd(logOutput, true, config.RootPath, expoCmd, prebuildArgs...); err != nil {
-		return "", fmt.Errorf("expo prebuild failed: %w", err)
-	}
-
 	// --- Update Build Number and Version Name in build.gradle ---
 	fmt.Fprintln(logOutput, "Updating build number and version name in build.gradle...")
-	buildGradlePath := filepath.Join(config.RootPath, "android", "app", "build.gradle")
-	buildGradleContent, err := os.ReadFile(buildGradlePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read build.gradle: %w", err)
-	}
-
-	updatedContent := strings.ReplaceAll(
-		string(buildGradleContent),
-		"versionCode 1", // Replace this with a more robust regex or logic if needed
-		fmt.Sprintf("versionCode %d", buildNumber),
-	)
-
-	updatedContent = strings.ReplaceAll(
-		updatedContent,
-		`versionName "1.0"`, // Replace this with a more robust regex or logic if needed
-		fmt.Sprintf(`versionName "%s"`, config.BuildVersion),
-	)
-
-	if err := os.WriteFile(buildGradlePath, []byte(updatedContent), 0644); err != nil {
-		return "", fmt.Errorf("failed to update build.gradle: %w", err)
+	if err := injectAndroidVersion(config.RootPath, config.BuildVersion, buildNumber, touched); err != nil {
+		return "", err
 	}
 	fmt.Fprintln(logOutput, "Build number and version name updated successfully.")
 
 	// --- Gradle Build ---
+	setLogStep(logOutput, "gradle")
 	gradleTask := fmt.Sprintf("assemble%s", config.Android.BuildType)
 	fmt.Fprintf(logOutput, "Running Gradle task: %s\n", gradleTask)
 	androidProjectDir := filepath.Join(config.RootPath, "android")
@@ -227,7 +305,7 @@ func buildAndroidGUI(config Config, buildNumber int, isMainBranch bool, logOutpu
 	}
 
 	if err := runCmd(logOutput, true, androidProjectDir, gradlewPath, gradleTask); err != nil {
-		return "", fmt.Errorf("gradle build failed (%s): %w", gradleTask, err)
+		return "", classifyGradleError(err, gradleTask)
 	}
 
 	// --- Locate and Move APK (Simplified - copy logic from original) ---
@@ -248,8 +326,7 @@ func buildAndroidGUI(config Config, buildNumber int, isMainBranch bool, logOutpu
 	destPath := filepath.Join(androidOutput, destFileName)
 
 	fmt.Fprintf(logOutput, "Moving APK to %s\n", destPath)
-	if err := os.Rename(apkSourcePath, destPath); err != nil {
-		// Add copy+delete fallback if needed
+	if err := moveFile(apkSourcePath, destPath); err != nil {
 		return "", fmt.Errorf("failed to move APK: %w", err)
 	}
 
@@ -258,8 +335,9 @@ func buildAndroidGUI(config Config, buildNumber int, isMainBranch bool, logOutpu
 }
 
 // Modify buildIOS similarly...
-func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io.Writer) (string, error) {
-	fmt.Fprintln(logOutput, "Building iOS app using prebuild and xcodebuild...")
+func buildIOSGUI(config Config, buildNumber int, currentBranch string, touched *fileSnapshot, logOutput io.Writer) (string, error) {
+	setLogStep(logOutput, "ios")
+	fmt.Fprintln(logOutput, "Building iOS app using xcodebuild...")
 	if runtime.GOOS != "darwin" {
 		return "", errors.New("iOS builds require macOS")
 	}
@@ -269,17 +347,18 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 		return "", fmt.Errorf("failed to create dir %s: %w", iosOutputDir, err)
 	}
 
-	// Prebuild
-	fmt.Fprintln(logOutput, "Running expo prebuild...")
-	expoCmd := "npx"
-	prebuildArgs := []string{"expo", "prebuild", "--platform", "ios", "--no-install"}
-	if err := runCmd(logOutput, true, config.RootPath, expoCmd, prebuildArgs...); err != nil {
-		return "", fmt.Errorf("expo prebuild failed: %w", err)
+	workspace, scheme, err := findIOSWorkspaceAndScheme(&config)
+	if err != nil {
+		return "", fmt.Errorf("ios workspace error: %w", err)
 	}
 
 	// Update build number, version, app name, and package ID in Info.plist
 	fmt.Fprintln(logOutput, "Updating build number, version, app name, and package ID in Info.plist...")
-	infoPlistPath := filepath.Join(config.RootPath, "ios", config.IOS.ProjectName, "Info.plist")
+	appDirName := config.IOS.ProjectName
+	if appDirName == "" {
+		appDirName = scheme // The app target folder is named after the project in both prebuild and RN CLI templates
+	}
+	infoPlistPath := filepath.Join(config.RootPath, "ios", appDirName, "Info.plist")
 	infoPlistContent, err := os.ReadFile(infoPlistPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read Info.plist: %w", err)
@@ -287,11 +366,6 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 
 	// Determine app name and package ID based on branch
 	var appName, packageID string
-	currentBranch, err := getCurrentGitBranch(config.RootPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to determine git branch: %w", err)
-	}
-
 	switch currentBranch {
 	case "main":
 		appName = "Sunflow Installer"
@@ -316,7 +390,7 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 	reCFBundleShortVersion := regexp.MustCompile(`<key>CFBundleShortVersionString</key>\s*<string>.*?</string>`)
 	updatedContent = reCFBundleShortVersion.ReplaceAllString(
 		updatedContent,
-		fmt.Sprintf("<key>CFBundleShortVersionString</key>\n\t<string>%s</string>", config.BuildVersion),
+		fmt.Sprintf("<key>CFBundleShortVersionString</key>\n\t<string>%s</string>", marketingVersion(config.BuildVersion)),
 	)
 
 	reCFBundleName := regexp.MustCompile(`<key>CFBundleName</key>\s*<string>.*?</string>`)
@@ -331,24 +405,27 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 		fmt.Sprintf("<key>CFBundleIdentifier</key>\n\t<string>%s</string>", packageID),
 	)
 
+	if err := touched.Track(infoPlistPath); err != nil {
+		return "", err
+	}
 	if err := os.WriteFile(infoPlistPath, []byte(updatedContent), 0644); err != nil {
 		return "", fmt.Errorf("failed to update Info.plist: %w", err)
 	}
 	fmt.Fprintln(logOutput, "Build number, version, app name, and package ID updated successfully.")
 
-	workspace, scheme, err := findIOSWorkspaceAndScheme(&config)
-	if err != nil {
-		return "", fmt.Errorf("ios workspace error: %w", err)
-	}
-
 	// Archive
+	setLogStep(logOutput, "archive")
 	fmt.Fprintln(logOutput, "Running xcodebuild archive...")
 	archiveName := fmt.Sprintf("%s.xcarchive", scheme)
 	archivePath := filepath.Join(config.RootPath, iosOutputDir, archiveName)
 	_ = os.RemoveAll(archivePath) // Clean previous
 
+	workspaceFlag := "-workspace"
+	if strings.HasSuffix(workspace, ".xcodeproj") {
+		workspaceFlag = "-project"
+	}
 	archiveArgs := []string{
-		"workspace",
+		workspaceFlag,
 		workspace,
 		"-scheme", scheme,
 		"-configuration", "Release",
@@ -356,15 +433,17 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 		"-archivePath", archivePath,
 		"archive",
 	}
+	archiveArgs = append(archiveArgs, xcodeVersionSettings(marketingVersion(config.BuildVersion), buildNumber)...)
 	if teamID := config.TeamID; teamID != "" {
 		archiveArgs = append(archiveArgs, fmt.Sprintf("DEVELOPMENT_TEAM=%s", teamID))
 	}
 	// Use xcodebuild directly, not via shell, as it's usually in PATH
 	if err := runCmd(logOutput, true, config.RootPath, "xcodebuild", archiveArgs...); err != nil {
-		return "", fmt.Errorf("xcodebuild archive failed: %w", err)
+		return "", classifyXcodebuildError(err, "archive")
 	}
 
 	// Export Archive
+	setLogStep(logOutput, "export")
 	fmt.Fprintln(logOutput, "Running xcodebuild exportArchive...")
 	exportDir := filepath.Join(config.RootPath, iosOutputDir, "export")
 	plistName := exportOptionsAppStorePlist
@@ -373,7 +452,11 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 		plistName = exportOptionsEnterprisePlist
 		exportMethod = "enterprise"
 	}
-	plistPath := filepath.Join(".", plistName)
+	// Absolute, since xcodebuild runs in the project (or worktree) rather than our cwd
+	plistPath, err := filepath.Abs(filepath.Join(config.RootPath, plistName))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", plistName, err)
+	}
 	if _, err := os.Stat(plistPath); err != nil {
 		return "", fmt.Errorf("exportOptionsPlist '%s' not found for %s export", plistPath, exportMethod)
 	}
@@ -386,7 +469,7 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 		"-exportOptionsPlist", plistPath,
 	}
 	if err := runCmd(logOutput, true, config.RootPath, "xcodebuild", exportArgs...); err != nil {
-		return "", fmt.Errorf("xcodebuild exportArchive failed: %w", err)
+		return "", classifyXcodebuildError(err, "exportArchive")
 	}
 
 	// Locate and Move IPA (Simplified)
@@ -406,7 +489,7 @@ func buildIOSGUI(config Config, buildNumber int, isMainBranch bool, logOutput io
 	destPath := filepath.Join(iosOutputDir, destFileName)
 
 	fmt.Fprintf(logOutput, "Moving IPA to %s\n", destPath)
-	if err := os.Rename(ipaSourcePath, destPath); err != nil {
+	if err := moveFile(ipaSourcePath, destPath); err != nil {
 		return "", fmt.Errorf("failed to move IPA: %w", err)
 	}
 
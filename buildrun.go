@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	appDataDirName     = "rn-builder"
+	runManifestFile    = "manifest.json"
+	runConfigFile      = "config.yaml"
+	runLogFile         = "build.log"
+	runJSONLogFile     = "build.jsonl"
+	runReleaseNotes    = "release-notes.md"
+	defaultMaxRuns     = 50 // Run folders kept when log_retention.max_runs is 0
+	defaultMaxAgeDays  = 30 // Age limit when log_retention.max_age_days is 0
+	runStatusRunning   = "running"
+	runStatusSucceeded = "succeeded"
+	runStatusFailed    = "failed"
+	runStatusCancelled = "cancelled"
+)
+
+// RunManifest describes one build run; it is saved as manifest.json in the run folder
+type RunManifest struct {
+	RunID         string    `json:"run_id"`
+	Status        string    `json:"status"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at,omitempty"`
+	Duration      float64   `json:"duration_seconds,omitempty"`
+	Version       string    `json:"version"`
+	BuildNumber   int       `json:"build_number,omitempty"`
+	Platform      string    `json:"platform"`
+	RootPath      string    `json:"root_path,omitempty"`
+	ProjectType   string    `json:"project_type,omitempty"`
+	Ref           string    `json:"ref,omitempty"`
+	Branch        string    `json:"branch,omitempty"`
+	BranchSource  string    `json:"branch_source,omitempty"`
+	Environment   string    `json:"environment,omitempty"`
+	Commit        string    `json:"commit,omitempty"`
+	Trigger       string    `json:"trigger,omitempty"` // manual, cli, api, watch or schedule:<name>
+	Artifacts     []string  `json:"artifacts,omitempty"`
+	ArtifactLinks []string  `json:"artifact_links,omitempty"` // Where uploaded artifacts can be downloaded
+	Error         string    `json:"error,omitempty"`
+	LikelyCauses  []string  `json:"likely_causes,omitempty"`
+
+	ReleaseNotes   *ReleaseNotes     `json:"release_notes,omitempty"`
+	PlatformStatus map[string]string `json:"platform_status,omitempty"` // succeeded, failed or cancelled per platform
+}
+
+// Save writes the manifest into dir
+func (m *RunManifest) Save(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, runManifestFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write run manifest: %w", err)
+	}
+	return nil
+}
+
+// LoadRunManifest reads manifest.json from a run folder
+func LoadRunManifest(dir string) (*RunManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, runManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run manifest: %w", err)
+	}
+	var m RunManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse run manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// BuildRun is a single build run with its own folder, log files and manifest
+type BuildRun struct {
+	ID       string
+	Dir      string
+	LogDir   string
+	Config   Config
+	Manifest *RunManifest
+
+	files     *LogWriter
+	logger    *RunLogger
+	diag      *Diagnoser
+	notifiers []Notifier
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// NewBuildRun creates the run folder (log files + config snapshot) and the run logger
+func NewBuildRun(config Config, sinks ...LogSink) (*BuildRun, error) {
+	rules, err := loadDiagnosisRules(config.DiagnosisRules)
+	if err != nil {
+		return nil, fmt.Errorf("error loading diagnosis rules: %w", err)
+	}
+	notifiers, err := newNotifiers(config.Notifications)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications config: %w", err)
+	}
+
+	logDir, err := resolveLogDir(config)
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err := filepath.Abs(config.RootPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root path: %w", err)
+	}
+	runID := newRunID()
+	runDir := filepath.Join(logDir, runID)
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	files, err := NewLogWriter(runDir, config.JSONLogs)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.SaveConfig(filepath.Join(runDir, runConfigFile)); err != nil {
+		files.Close()
+		return nil, fmt.Errorf("failed to write config snapshot: %w", err)
+	}
+
+	r := &BuildRun{
+		ID:     runID,
+		Dir:    runDir,
+		LogDir: logDir,
+		Config: config,
+		Manifest: &RunManifest{
+			RunID:     runID,
+			Status:    runStatusRunning,
+			StartedAt: time.Now(),
+			Version:   config.BuildVersion,
+			Platform:  config.Platform,
+			RootPath:  absRoot,
+			Trigger:   config.Trigger,
+		},
+		files:     files,
+		diag:      NewDiagnoser(rules),
+		notifiers: notifiers,
+	}
+	// Every record, including command output streamed through runCmd, also goes to the diagnoser
+	r.logger = NewRunLogger(runID, append([]LogSink{files, r.diag}, sinks...)...)
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.logger.SetContext(r.ctx)
+	if err := r.Manifest.Save(runDir); err != nil {
+		r.cancel()
+		files.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Cancel stops the run: the running command is killed and no further steps start.
+// Files the build edited are still restored. Safe to call from any goroutine.
+func (r *BuildRun) Cancel() {
+	r.cancel()
+}
+
+// LogPath returns the path of the human-readable log for this run
+func (r *BuildRun) LogPath() string {
+	return r.files.Path()
+}
+
+// Execute runs the build steps, then finalizes the manifest, closes the log files and
+// applies log retention. Known-failure diagnoses are attached to the returned error.
+func (r *BuildRun) Execute() error {
+	fmt.Fprintf(r.logger, "Run ID: %s\n", r.ID)
+	fmt.Fprintf(r.logger, "Run folder: %s\n", r.Dir)
+	r.notify(eventStart)
+
+	err := runBuildSteps(r.Config, r.logger, r.Manifest, r.Dir)
+	if err != nil && r.ctx.Err() != nil {
+		err = errBuildCancelled // Whatever failed, it failed because it was stopped
+	} else if err != nil {
+		if diagnoses := r.diag.Diagnoses(); len(diagnoses) > 0 {
+			err = &DiagnosedError{Err: err, Diagnoses: diagnoses}
+		}
+	}
+	r.finish(err)
+	return err
+}
+
+// finish records the outcome in the log and manifest and releases the log files
+func (r *BuildRun) finish(err error) {
+	r.logger.EndStep(err)
+	m := r.Manifest
+	m.FinishedAt = time.Now()
+	m.Duration = m.FinishedAt.Sub(m.StartedAt).Round(time.Second).Seconds()
+	if errors.Is(err, errBuildCancelled) {
+		m.Status = runStatusCancelled
+		m.Error = err.Error()
+		fmt.Fprintln(r.logger, "BUILD CANCELLED")
+	} else if err != nil {
+		m.Status = runStatusFailed
+		m.Error = err.Error()
+		fmt.Fprintf(r.logger, "BUILD FAILED: %v\n", err)
+		if diagnoses := diagnosesFromError(err); len(diagnoses) > 0 {
+			fmt.Fprintf(r.logger, "Likely cause:\n%s", formatDiagnoses(diagnoses))
+			for _, d := range diagnoses {
+				m.LikelyCauses = append(m.LikelyCauses, d.Rule.Explanation)
+			}
+		}
+	} else {
+		m.Status = runStatusSucceeded
+		fmt.Fprintln(r.logger, "BUILD SUCCEEDED!")
+	}
+
+	if m.ReleaseNotes != nil {
+		if writeErr := os.WriteFile(filepath.Join(r.Dir, runReleaseNotes), []byte(m.ReleaseNotes.Markdown()), 0644); writeErr != nil {
+			fmt.Fprintf(r.logger, "Warning: failed to write release notes: %v\n", writeErr)
+		}
+	}
+	if saveErr := m.Save(r.Dir); saveErr != nil {
+		fmt.Fprintf(r.logger, "Warning: %v\n", saveErr)
+	}
+	if err != nil {
+		r.notify(eventFailure)
+	} else {
+		r.notify(eventSuccess)
+	}
+	r.files.Close()
+	r.cancel() // Release the context
+
+	maxRuns, maxAge := logRetentionLimits(r.Config)
+	if pruneErr := pruneRunDirs(r.LogDir, maxRuns, maxAge, r.ID); pruneErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to prune old runs: %v\n", pruneErr)
+	}
+}
+
+// notify sends event with a snapshot of the manifest to the configured notifiers
+func (r *BuildRun) notify(event string) {
+	if len(r.notifiers) == 0 {
+		return
+	}
+	e := BuildEvent{Event: event, Manifest: *r.Manifest, LogPath: r.LogPath()}
+	if event == eventFailure {
+		tail, err := r.files.Tail(notifyLogTailLines)
+		if err != nil {
+			fmt.Fprintf(r.logger, "Warning: %v\n", err)
+		}
+		e.LogTail = tail
+	}
+	notifyAll(r.notifiers, e, r.logger)
+}
+
+// userDataDir returns the per-user application data directory for rn-builder
+func userDataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+
+	var base string
+	switch runtime.GOOS {
+	case "darwin":
+		base = filepath.Join(home, "Library", "Application Support")
+	case "windows":
+		base = os.Getenv("LOCALAPPDATA")
+		if base == "" {
+			base = filepath.Join(home, "AppData", "Local")
+		}
+	default:
+		base = os.Getenv("XDG_DATA_HOME")
+		if base == "" {
+			base = filepath.Join(home, ".local", "share")
+		}
+	}
+	return filepath.Join(base, appDataDirName), nil
+}
+
+// resolveLogDir returns the configured log directory, defaulting to <user data dir>/logs
+func resolveLogDir(config Config) (string, error) {
+	if config.LogDir != "" {
+		return config.LogDir, nil
+	}
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "logs"), nil
+}
+
+// logRetentionLimits applies defaults: 0 means default, negative means unlimited
+func logRetentionLimits(config Config) (maxRuns int, maxAge time.Duration) {
+	maxRuns = config.LogRetention.MaxRuns
+	if maxRuns == 0 {
+		maxRuns = defaultMaxRuns
+	}
+	maxAgeDays := config.LogRetention.MaxAgeDays
+	if maxAgeDays == 0 {
+		maxAgeDays = defaultMaxAgeDays
+	}
+	if maxAgeDays > 0 {
+		maxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+	}
+	return maxRuns, maxAge
+}
+
+// listRunDirs returns the run folders in logDir (those with a manifest), newest first
+func listRunDirs(logDir string) ([]string, error) {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(logDir, entry.Name(), runManifestFile)); err == nil {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	// Run IDs start with a timestamp, so name order is chronological
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	return dirs, nil
+}
+
+// pruneRunDirs removes run folders beyond maxRuns or older than maxAge, never touching keepID
+func pruneRunDirs(logDir string, maxRuns int, maxAge time.Duration, keepID string) error {
+	dirs, err := listRunDirs(logDir)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for i, name := range dirs {
+		if name == keepID {
+			continue
+		}
+		remove := maxRuns > 0 && i >= maxRuns
+		if !remove && maxAge > 0 {
+			if info, err := os.Stat(filepath.Join(logDir, name, runManifestFile)); err == nil && time.Since(info.ModTime()) > maxAge {
+				remove = true
+			}
+		}
+		if remove {
+			if err := os.RemoveAll(filepath.Join(logDir, name)); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
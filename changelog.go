@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxChangelogCommits = 200  // Commits listed when there is no earlier build to compare with, or too many since it
+	whatToTestMaxChars  = 4000 // TestFlight's limit for "What to Test"
+	whatToTestFile      = "WhatToTest.en-US.txt"
+)
+
+var conventionalCommitRe = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+
+// changelogGroups are the release note sections in display order, keyed by conventional-commit type
+var changelogGroups = []struct {
+	title string
+	types []string
+}{
+	{"Breaking Changes", nil}, // Any type with "!" or a BREAKING CHANGE footer
+	{"Features", []string{"feat"}},
+	{"Bug Fixes", []string{"fix"}},
+	{"Performance", []string{"perf"}},
+	{"Refactoring", []string{"refactor"}},
+	{"Documentation", []string{"docs"}},
+	{"Other Changes", nil}, // Everything else, including non-conventional subjects
+}
+
+// ChangelogEntry is one commit in the release notes
+type ChangelogEntry struct {
+	Hash    string `json:"hash"`
+	Scope   string `json:"scope,omitempty"`
+	Subject string `json:"subject"`
+}
+
+// ChangelogSection is a titled group of entries
+type ChangelogSection struct {
+	Title   string           `json:"title"`
+	Entries []ChangelogEntry `json:"entries"`
+}
+
+// ReleaseNotes are the changes between the previous successful build and this one
+type ReleaseNotes struct {
+	Since     string             `json:"since,omitempty"`      // Commit the notes start after ("" for the first build)
+	SinceFrom string             `json:"since_from,omitempty"` // How Since was found (build history, tag)
+	Sections  []ChangelogSection `json:"sections,omitempty"`
+	Truncated bool               `json:"truncated,omitempty"`
+}
+
+// previousBuildCommit finds the commit of the last successful build of this project and
+// branch that is an ancestor of HEAD, falling back to the latest release tag
+func previousBuildCommit(config Config, projectRoot, branch, version string) (commit string, from string) {
+	if logDir, err := resolveLogDir(config); err == nil {
+		if dirs, err := listRunDirs(logDir); err == nil {
+			for _, name := range dirs {
+				m, err := LoadRunManifest(filepath.Join(logDir, name))
+				if err != nil || m.Status != runStatusSucceeded || m.Commit == "" {
+					continue
+				}
+				if m.RootPath != projectRoot || m.Branch != branch {
+					continue
+				}
+				if _, err := gitOutput(config.RootPath, "merge-base", "--is-ancestor", m.Commit, "HEAD"); err == nil {
+					return m.Commit, fmt.Sprintf("build %s (%s)", m.RunID, m.Version)
+				}
+			}
+		}
+	}
+
+	// The newest v* tag reachable from HEAD, other than the one this build would create
+	tag, err := gitOutput(config.RootPath, "describe", "--tags", "--abbrev=0", "--match", "v*", "--exclude", "v"+version, "HEAD")
+	if err == nil && tag != "" {
+		if sha, err := gitOutput(config.RootPath, "rev-list", "-n", "1", tag); err == nil {
+			return sha, "tag " + tag
+		}
+	}
+	return "", ""
+}
+
+// collectReleaseNotes groups the commit subjects after since (up to HEAD) by conventional-commit type
+func collectReleaseNotes(rootPath, since, sinceFrom string) (*ReleaseNotes, error) {
+	args := []string{"log", "--no-merges", fmt.Sprintf("--max-count=%d", maxChangelogCommits+1), "--format=%h%x1f%s%x1f%b%x1e"}
+	if since != "" {
+		args = append(args, since+"..HEAD")
+	} else {
+		args = append(args, "HEAD")
+	}
+	output, err := gitOutput(rootPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git history: %w", err)
+	}
+
+	notes := &ReleaseNotes{Since: since, SinceFrom: sinceFrom}
+	buckets := make([][]ChangelogEntry, len(changelogGroups))
+	records := strings.Split(output, "\x1e")
+	count := 0
+	for _, record := range records {
+		fields := strings.SplitN(strings.TrimSpace(record), "\x1f", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		if count == maxChangelogCommits {
+			notes.Truncated = true
+			break
+		}
+		count++
+
+		entry := ChangelogEntry{Hash: fields[0], Subject: fields[1]}
+		group := len(changelogGroups) - 1 // Other Changes
+		if m := conventionalCommitRe.FindStringSubmatch(fields[1]); m != nil {
+			commitType := strings.ToLower(m[1])
+			for i, g := range changelogGroups {
+				for _, t := range g.types {
+					if t == commitType {
+						group = i
+					}
+				}
+			}
+			if m[3] == "!" || (len(fields) == 3 && strings.Contains(fields[2], "BREAKING CHANGE")) {
+				group = 0
+			}
+			// The section title replaces the type; under Other Changes (chore, ci, ...) it stays
+			if group != len(changelogGroups)-1 {
+				entry.Scope, entry.Subject = m[2], m[4]
+			}
+		}
+		buckets[group] = append(buckets[group], entry)
+	}
+
+	for i, g := range changelogGroups {
+		if len(buckets[i]) > 0 {
+			notes.Sections = append(notes.Sections, ChangelogSection{Title: g.title, Entries: buckets[i]})
+		}
+	}
+	return notes, nil
+}
+
+// Empty reports whether there are no changes to list
+func (n *ReleaseNotes) Empty() bool {
+	return len(n.Sections) == 0
+}
+
+func (e ChangelogEntry) line() string {
+	if e.Scope != "" {
+		return fmt.Sprintf("%s: %s", e.Scope, e.Subject)
+	}
+	return e.Subject
+}
+
+// Markdown renders the notes with a heading per section
+func (n *ReleaseNotes) Markdown() string {
+	if n.Empty() {
+		return "_No changes since the previous build._\n"
+	}
+	var b strings.Builder
+	for i, s := range n.Sections {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "### %s\n\n", s.Title)
+		for _, e := range s.Entries {
+			fmt.Fprintf(&b, "- %s (%s)\n", e.line(), e.Hash)
+		}
+	}
+	if n.Truncated {
+		fmt.Fprintf(&b, "\n_Only the latest %d changes are listed._\n", maxChangelogCommits)
+	}
+	return b.String()
+}
+
+// Text renders the notes as plain text, for Drive descriptions, TestFlight and e-mail
+func (n *ReleaseNotes) Text() string {
+	if n.Empty() {
+		return "No changes since the previous build.\n"
+	}
+	var b strings.Builder
+	for i, s := range n.Sections {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s:\n", s.Title)
+		for _, e := range s.Entries {
+			fmt.Fprintf(&b, "* %s\n", e.line())
+		}
+	}
+	if n.Truncated {
+		fmt.Fprintf(&b, "\n(Only the latest %d changes are listed.)\n", maxChangelogCommits)
+	}
+	return b.String()
+}
+
+// driveDescription is the Drive file description for a build: version, branch and release notes
+func driveDescription(m *RunManifest) string {
+	desc := fmt.Sprintf("Version %s (build %d), branch %s", m.Version, m.BuildNumber, m.Branch)
+	if m.Commit != "" {
+		desc += fmt.Sprintf(", commit %.7s", m.Commit)
+	}
+	if m.ReleaseNotes != nil {
+		desc += "\n\n" + m.ReleaseNotes.Text()
+	}
+	return desc
+}
+
+// whatToTestText is the plain-text notes cut to TestFlight's What to Test limit
+func whatToTestText(notes *ReleaseNotes) string {
+	text := notes.Text()
+	if len(text) > whatToTestMaxChars {
+		text = strings.ToValidUTF8(text[:whatToTestMaxChars-4], "") + "\n..."
+	}
+	return text
+}
+
+// writeWhatToTest writes the What to Test text next to the IPA; the upload sets it on the
+// build through the App Store Connect API when app_store_connect is configured
+func writeWhatToTest(dir string, notes *ReleaseNotes, logOutput io.Writer) error {
+	path := filepath.Join(dir, whatToTestFile)
+	if err := os.WriteFile(path, []byte(whatToTestText(notes)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", whatToTestFile, err)
+	}
+	fmt.Fprintf(logOutput, "TestFlight notes written to %s\n", path)
+	return nil
+}
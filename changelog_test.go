@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// commitAll commits every change in dir with message
+func commitAll(t *testing.T, dir, message string) {
+	t.Helper()
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "--allow-empty", "-m", message)
+}
+
+func TestCollectReleaseNotes(t *testing.T) {
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q")
+	commitAll(t, dir, "chore: initial commit")
+	since := strings.TrimSpace(gitRun(t, dir, "rev-parse", "HEAD"))
+
+	for _, message := range []string{
+		"feat(login): add biometric login",
+		"fix: crash on launch",
+		"Fix: typo in settings",
+		"feat(api)!: drop v1 endpoints",
+		"refactor: split auth service\n\nBREAKING CHANGE: AuthService is now two classes",
+		"perf: faster image cache",
+		"docs: update README",
+		"chore(deps): bump react-native",
+		"Update translations",
+	} {
+		commitAll(t, dir, message)
+	}
+	gitRun(t, dir, "checkout", "-q", "-b", "topic")
+	commitAll(t, dir, "feat: on a topic branch")
+	gitRun(t, dir, "checkout", "-q", "-")
+	gitRun(t, dir, "merge", "-q", "--no-ff", "-m", "Merge branch 'topic'", "topic")
+
+	notes, err := collectReleaseNotes(dir, since, "tag v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	var titles []string
+	for _, s := range notes.Sections {
+		titles = append(titles, s.Title)
+		for _, e := range s.Entries {
+			got[s.Title] = append(got[s.Title], e.line())
+		}
+	}
+
+	wantTitles := "Breaking Changes|Features|Bug Fixes|Performance|Documentation|Other Changes"
+	if strings.Join(titles, "|") != wantTitles {
+		t.Errorf("sections = %q, want %s", titles, wantTitles)
+	}
+	// git log lists the newest commit first; the BREAKING CHANGE refactor leaves Refactoring empty
+	want := map[string][]string{
+		"Breaking Changes": {"split auth service", "api: drop v1 endpoints"},
+		"Features":         {"on a topic branch", "login: add biometric login"},
+		"Bug Fixes":        {"typo in settings", "crash on launch"},
+		"Performance":      {"faster image cache"},
+		"Documentation":    {"update README"},
+		"Other Changes":    {"Update translations", "chore(deps): bump react-native"},
+	}
+	for title, lines := range want {
+		if strings.Join(got[title], "|") != strings.Join(lines, "|") {
+			t.Errorf("%s = %q, want %q", title, got[title], lines)
+		}
+	}
+	if notes.Since != since || notes.Truncated {
+		t.Errorf("since = %q, truncated = %v", notes.Since, notes.Truncated)
+	}
+}
+
+func TestReleaseNotesRendering(t *testing.T) {
+	notes := &ReleaseNotes{Sections: []ChangelogSection{
+		{Title: "Breaking Changes", Entries: []ChangelogEntry{{Hash: "abc1234", Scope: "api", Subject: "drop v1 endpoints"}}},
+		{Title: "Bug Fixes", Entries: []ChangelogEntry{{Hash: "def5678", Subject: "crash on launch"}}},
+	}}
+	wantMarkdown := "### Breaking Changes\n\n- api: drop v1 endpoints (abc1234)\n\n### Bug Fixes\n\n- crash on launch (def5678)\n"
+	if got := notes.Markdown(); got != wantMarkdown {
+		t.Errorf("Markdown() = %q, want %q", got, wantMarkdown)
+	}
+	wantText := "Breaking Changes:\n* api: drop v1 endpoints\n\nBug Fixes:\n* crash on launch\n"
+	if got := notes.Text(); got != wantText {
+		t.Errorf("Text() = %q, want %q", got, wantText)
+	}
+	if got := (&ReleaseNotes{}).Markdown(); !strings.Contains(got, "No changes") {
+		t.Errorf("empty Markdown() = %q", got)
+	}
+}
+
+func TestWriteWhatToTestLimit(t *testing.T) {
+	entries := make([]ChangelogEntry, 500)
+	for i := range entries {
+		entries[i] = ChangelogEntry{Hash: "abc1234", Subject: "a change with a fairly long subject line"}
+	}
+	notes := &ReleaseNotes{Sections: []ChangelogSection{{Title: "Features", Entries: entries}}}
+	dir := t.TempDir()
+	if err := writeWhatToTest(dir, notes, &strings.Builder{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, whatToTestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > whatToTestMaxChars || !strings.HasSuffix(string(data), "\n...") {
+		t.Errorf("What to Test is %d bytes, ending %q", len(data), data[len(data)-10:])
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runCLI handles command-line invocations and returns the process exit code
+func runCLI(args []string) int {
+	switch args[0] {
+	case "build":
+		return runBuildCommand(args[1:])
+	case "version":
+		return runVersionCommand(args[1:])
+	case "serve":
+		return runServeCommand(args[1:])
+	case "watch":
+		return runWatchCommand(args[1:])
+	case "help", "-h", "--help":
+		printUsage(os.Stdout)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: rn-builder [command] [flags]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Without a command the GUI is started.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, "  build    Run a build headless using a config file")
+	fmt.Fprintln(w, "  version  Show the version, or bump it: version bump major|minor|patch")
+	fmt.Fprintln(w, "  serve    Run the REST API for submitting and following builds (token in RN_BUILDER_TOKEN)")
+	fmt.Fprintln(w, "  watch    Poll the git remote and build new commits on the branches in the watch section")
+	fmt.Fprintln(w, "  help     Show this help")
+}
+
+// runBuildCommand runs a headless build: rn-builder build [-config file] [-platform p] [-version v] [-ref r] [-branch b] [-json-log file]
+func runBuildCommand(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfig, "Path to the config file")
+	platform := fs.String("platform", "", "Override platform (all, android, ios)")
+	version := fs.String("version", "", "Override build version (X.Y.Z)")
+	ref := fs.String("ref", "", "Build this branch, tag or SHA in a temporary git worktree")
+	branch := fs.String("branch", "", "Override the branch the environment is chosen from")
+	jsonLog := fs.String("json-log", "", "Also write JSON-lines log records to this file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	overrides := BuildRequest{Platform: *platform, Version: *version, Ref: *ref, Branch: *branch, Trigger: triggerCLI}
+	if err := overrides.apply(config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	sinks := []LogSink{&textSink{w: os.Stdout}}
+	if *jsonLog != "" {
+		file, err := os.Create(*jsonLog)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to create JSON log file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		sinks = append(sinks, &jsonLinesSink{w: file})
+	}
+
+	run, err := NewBuildRun(*config, sinks...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	// Ctrl+C cancels the build, which still restores the files it edited
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+	go func() {
+		if _, ok := <-interrupts; ok {
+			fmt.Fprintln(os.Stderr, "Interrupted, cancelling build...")
+			run.Cancel()
+		}
+	}()
+
+	if err := run.Execute(); err != nil {
+		// The failure itself is already in the log output; add the summary
+		if diagnoses := diagnosesFromError(err); len(diagnoses) > 0 {
+			fmt.Fprintf(os.Stderr, "\nLikely cause:\n%s", formatDiagnoses(diagnoses))
+		}
+		fmt.Fprintf(os.Stderr, "\nFull log: %s\n", run.LogPath())
+		return 1
+	}
+	return 0
+}
+
+// runVersionCommand prints the current version or bumps it:
+// rn-builder version [-config file]
+// rn-builder version bump [-config file] [-no-commit] major|minor|patch
+func runVersionCommand(args []string) int {
+	bump := len(args) > 0 && args[0] == "bump"
+	if bump {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfig, "Path to the config file")
+	noCommit := fs.Bool("no-commit", false, "Update the version files without committing them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if !bump {
+		version, from := config.BuildVersion, "config"
+		if config.VersionSource != "" && config.VersionSource != versionSourceConfig {
+			if version, from, err = readVersionFromSource(config.RootPath, config.VersionSource); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+		}
+		buildNumber, err := calculateBuildNumber(version, config.BuildNumberScheme)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s (build %d, from %s)\n", version, buildNumber, from)
+		return 0
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: rn-builder version bump [-config file] [-no-commit] major|minor|patch")
+		return 2
+	}
+	if _, err := bumpVersion(*config, *configPath, fs.Arg(0), !*noCommit, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CommandError is returned by runCmd when a command fails to start or exits non-zero
+type CommandError struct {
+	Command    string        // Command line as it was requested (before shell wrapping)
+	ExitCode   int           // Process exit code, -1 if the process never started
+	Duration   time.Duration // Wall-clock time the command ran for
+	StderrTail []string      // Last lines written to stderr
+	StdoutTail []string      // Last lines written to stdout (some tools report errors there)
+	Err        error         // Underlying error from os/exec
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("command %q failed (exit code %d after %s)", e.Command, e.ExitCode, e.Duration.Round(time.Second))
+	if last := e.LastStderrLine(); last != "" {
+		msg += ": " + last
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// LastStderrLine returns the last non-empty stderr line, if any
+func (e *CommandError) LastStderrLine() string {
+	for i := len(e.StderrTail) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(e.StderrTail[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// StderrContains reports whether any captured stderr line contains one of the substrings (case-insensitive)
+func (e *CommandError) StderrContains(substrs ...string) bool {
+	return linesContain(e.StderrTail, substrs)
+}
+
+// OutputContains is like StderrContains but also searches the captured stdout lines
+func (e *CommandError) OutputContains(substrs ...string) bool {
+	return linesContain(e.StderrTail, substrs) || linesContain(e.StdoutTail, substrs)
+}
+
+func linesContain(lines []string, substrs []string) bool {
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		for _, s := range substrs {
+			if strings.Contains(lower, strings.ToLower(s)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// classifyAltoolError turns a failed altool upload into an actionable message. altool
+// prints most errors on stdout, so both streams are searched.
+func classifyAltoolError(err error, passwordArg string) error {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return fmt.Errorf("TestFlight upload command failed: %w", err)
+	}
+
+	switch {
+	case cmdErr.OutputContains("Authentication failed", "status 401", "Unable to validate your application", "-22938", "-22020"):
+		return fmt.Errorf("TestFlight upload authentication failed. Check Apple ID, password/keychain item (%s), and potentially 2FA requirements: %w", passwordArg, err)
+	case cmdErr.OutputContains("bundle version must be higher", "redundant binary upload", "-19232"):
+		return fmt.Errorf("TestFlight rejected the build number as already used. Bump the build version and rebuild: %w", err)
+	case cmdErr.OutputContains("No suitable application records were found", "-19201"):
+		return fmt.Errorf("no App Store Connect app matches this bundle identifier. Create the app record or check the bundle ID: %w", err)
+	case cmdErr.OutputContains("Could not find the keychain item", "item could not be found in the keychain"):
+		return fmt.Errorf("App Store Connect password not found in keychain. Add an app-specific password as 'AC_PASSWORD' or set APP_STORE_CONNECT_PASSWORD: %w", err)
+	}
+	return fmt.Errorf("TestFlight upload command failed: %w", err)
+}
+
+// classifyGradleError turns a failed Gradle task into an actionable message
+func classifyGradleError(err error, task string) error {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return fmt.Errorf("gradle build failed (%s): %w", task, err)
+	}
+
+	switch {
+	case cmdErr.StderrContains("SDK location not found", "ANDROID_HOME", "ANDROID_SDK_ROOT"):
+		return fmt.Errorf("gradle could not find the Android SDK. Set ANDROID_HOME or sdk.dir in android/local.properties: %w", err)
+	case cmdErr.StderrContains("licences have not been accepted", "licenses have not been accepted"):
+		return fmt.Errorf("android SDK licences are not accepted. Run 'sdkmanager --licenses': %w", err)
+	case cmdErr.StderrContains("Unsupported class file major version", "requires Java", "incompatible Java", "Android Gradle plugin requires Java"):
+		return fmt.Errorf("gradle is running with an unsupported Java version. Point JAVA_HOME at the JDK required by the Android Gradle plugin: %w", err)
+	case cmdErr.StderrContains("Task '"+task+"' not found", "not found in root project"):
+		return fmt.Errorf("gradle task %s does not exist. Check android.build_type matches a build type or flavor: %w", task, err)
+	case cmdErr.StderrContains("Keystore file", "keystore password was incorrect", "Failed to read key"):
+		return fmt.Errorf("android release signing failed. Check the keystore path and passwords in gradle.properties: %w", err)
+	case cmdErr.StderrContains("OutOfMemoryError", "Java heap space", "Metaspace"):
+		return fmt.Errorf("gradle ran out of memory. Raise org.gradle.jvmargs in android/gradle.properties: %w", err)
+	}
+	return fmt.Errorf("gradle build failed (%s): %w", task, err)
+}
+
+// classifyXcodebuildError turns a failed xcodebuild action into an actionable message.
+// xcodebuild reports signing, scheme and export errors on stdout, so both streams are searched.
+func classifyXcodebuildError(err error, action string) error {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return fmt.Errorf("xcodebuild %s failed: %w", action, err)
+	}
+
+	switch {
+	case cmdErr.OutputContains("No signing certificate", "No certificate for team", "signing identity"):
+		return fmt.Errorf("xcodebuild %s failed: no usable signing certificate in the keychain. Install the distribution certificate or check team_id: %w", action, err)
+	case cmdErr.OutputContains("No profiles for", "requires a provisioning profile", "provisioning profile"):
+		return fmt.Errorf("xcodebuild %s failed: no matching provisioning profile. Download it in Xcode or enable automatic signing: %w", action, err)
+	case cmdErr.OutputContains("does not contain a scheme", "is not a valid scheme"):
+		return fmt.Errorf("xcodebuild %s failed: scheme not found. Set ios.scheme in the config: %w", action, err)
+	case cmdErr.OutputContains("The sandbox is not in sync with the Podfile.lock"):
+		return fmt.Errorf("xcodebuild %s failed: CocoaPods are out of date. Run 'pod install' in the ios directory: %w", action, err)
+	case cmdErr.OutputContains("exportOptionsPlist", "error: exportArchive"):
+		return fmt.Errorf("xcodebuild %s failed: export options do not match the signing setup. Check %s / %s: %w", action, exportOptionsAppStorePlist, exportOptionsEnterprisePlist, err)
+	}
+	return fmt.Errorf("xcodebuild %s failed: %w", action, err)
+}
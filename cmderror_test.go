@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// sampleCmdErr builds a CommandError from captured output, one line per newline
+func sampleCmdErr(stdout, stderr string) error {
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(strings.TrimSpace(s), "\n")
+	}
+	return &CommandError{Command: "tool", ExitCode: 1, StdoutTail: split(stdout), StderrTail: split(stderr), Err: errors.New("exit status 1")}
+}
+
+func TestClassifyAltoolError(t *testing.T) {
+	tests := []struct {
+		name, stdout, stderr, want string
+	}{
+		{
+			name: "authentication",
+			stdout: `2024-05-01 10:00:00.000 *** Error: Error uploading 'App.ipa'.
+2024-05-01 10:00:00.000 *** Error: Unable to upload archive. Failed to get authorization for username 'dev@example.com' and password. (
+    "Error Domain=NSCocoaErrorDomain Code=-1011 \"Authentication failed\" UserInfo={NSLocalizedDescription=Authentication failed, NSLocalizedFailureReason=Failed to authenticate for session: (\n    \"Error Domain=ITunesConnectionAuthenticationErrorDomain Code=-22938 \\\"Sign in with the app-specific password you generated.\"
+)`,
+			want: "authentication failed",
+		},
+		{
+			name: "duplicate build number",
+			stdout: `*** Error: Error uploading 'App.ipa'.
+*** Error: The bundle version must be higher than the previously uploaded version: ‘10203’. (-19232)
+ {
+    NSLocalizedDescription = "The bundle version must be higher than the previously uploaded version.";
+}`,
+			want: "build number as already used",
+		},
+		{
+			name:   "missing app record",
+			stdout: `*** Error: Error uploading 'App.ipa'. *** Error: No suitable application records were found. Verify your bundle identifier 'com.example.app' is correct. (-19201)`,
+			want:   "no App Store Connect app",
+		},
+		{
+			name:   "keychain item on stderr",
+			stderr: `xcrun: error: Could not find the keychain item 'AC_PASSWORD'.`,
+			want:   "not found in keychain",
+		},
+		{
+			name:   "unknown failure",
+			stdout: `*** Error: Error uploading 'App.ipa'. Network unavailable`,
+			want:   "TestFlight upload command failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyAltoolError(sampleCmdErr(tt.stdout, tt.stderr), "@env:APP_STORE_CONNECT_PASSWORD")
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("classified as %q, want it to mention %q", err, tt.want)
+			}
+			var cmdErr *CommandError
+			if !errors.As(err, &cmdErr) {
+				t.Error("CommandError is not wrapped")
+			}
+		})
+	}
+}
+
+func TestClassifyGradleError(t *testing.T) {
+	tests := []struct {
+		name, stdout, stderr, want string
+	}{
+		{
+			name: "missing SDK",
+			stderr: `FAILURE: Build failed with an exception.
+
+* What went wrong:
+Could not determine the dependencies of task ':app:compileReleaseJavaWithJavac'.
+> SDK location not found. Define a valid SDK location with an ANDROID_HOME environment variable or by setting the sdk.dir path in your project's local properties file at '/app/android/local.properties'.`,
+			want: "could not find the Android SDK",
+		},
+		{
+			name: "licences",
+			stderr: `* What went wrong:
+Could not determine the dependencies of task ':app:compileReleaseJavaWithJavac'.
+> Failed to install the following Android SDK packages as some licences have not been accepted.
+     build-tools;34.0.0 Android SDK Build-Tools 34`,
+			want: "licences are not accepted",
+		},
+		{
+			name: "java version",
+			stderr: `* What went wrong:
+An exception occurred applying plugin request [id: 'com.android.application']
+> Failed to apply plugin 'com.android.internal.application'.
+   > Android Gradle plugin requires Java 17 to run. You are currently using Java 11.`,
+			want: "unsupported Java version",
+		},
+		{
+			name: "missing task",
+			stderr: `* What went wrong:
+Task 'assembleProductionRelease' not found in root project 'MyApp'.`,
+			want: "does not exist",
+		},
+		{
+			name: "keystore",
+			stderr: `* What went wrong:
+Execution failed for task ':app:packageRelease'.
+> A failure occurred while executing com.android.build.gradle.tasks.PackageAndroidArtifact$IncrementalSplitterRunnable
+   > com.android.ide.common.signing.KeytoolException: Failed to read key upload from store "/app/android/app/upload.keystore": Keystore was tampered with, or password was incorrect`,
+			want: "signing failed",
+		},
+		{
+			name: "out of memory",
+			stderr: `Execution failed for task ':app:mergeDexRelease'.
+> java.lang.OutOfMemoryError: Java heap space`,
+			want: "ran out of memory",
+		},
+		{
+			name:   "errors on stdout only are not classified",
+			stdout: `SDK location not found.`,
+			want:   "gradle build failed (assembleProductionRelease)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyGradleError(sampleCmdErr(tt.stdout, tt.stderr), "assembleProductionRelease")
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("classified as %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyXcodebuildError(t *testing.T) {
+	tests := []struct {
+		name, stdout, stderr, want string
+	}{
+		{
+			name: "no certificate",
+			stdout: `/app/ios/MyApp.xcodeproj: error: No signing certificate "iOS Distribution" found: No "iOS Distribution" signing certificate matching team ID "ABCDE12345" with a private key was found. (in target 'MyApp' from project 'MyApp')
+** ARCHIVE FAILED **`,
+			want: "no usable signing certificate",
+		},
+		{
+			name: "no profile",
+			stdout: `/app/ios/MyApp.xcodeproj: error: No profiles for 'com.example.app' were found: Xcode couldn't find any iOS App Development provisioning profiles matching 'com.example.app'. (in target 'MyApp' from project 'MyApp')
+** ARCHIVE FAILED **`,
+			want: "no matching provisioning profile",
+		},
+		{
+			name:   "scheme",
+			stderr: `xcodebuild: error: The workspace named "MyApp" does not contain a scheme named "MyAppProd". The "-list" option can be used to find the names of the schemes in the workspace.`,
+			want:   "scheme not found",
+		},
+		{
+			name: "pods out of date",
+			stdout: `error: The sandbox is not in sync with the Podfile.lock. Run 'pod install' or update your CocoaPods installation. (in target 'MyApp' from project 'MyApp')
+** ARCHIVE FAILED **`,
+			want: "CocoaPods are out of date",
+		},
+		{
+			name: "export",
+			stderr: `error: exportArchive: "MyApp.app" requires a provisioning profile with the Push Notifications feature.
+
+Error Domain=IDEProvisioningErrorDomain Code=9 ""MyApp.app" requires a provisioning profile with the Push Notifications feature."`,
+			want: "no matching provisioning profile",
+		},
+		{
+			name:   "export options",
+			stderr: `error: exportArchive: exportOptionsPlist error for key 'method': expected one of {app-store, ad-hoc, enterprise, development}`,
+			want:   "export options do not match",
+		},
+		{
+			name:   "compile error",
+			stdout: "/app/ios/MyApp/AppDelegate.mm:12:3: error: use of undeclared identifier 'foo'\n** ARCHIVE FAILED **",
+			want:   "xcodebuild archive failed: command",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyXcodebuildError(sampleCmdErr(tt.stdout, tt.stderr), "archive")
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("classified as %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifySeesEarlyStdoutErrors(t *testing.T) {
+	// The signing error is followed by a long tail of build output, as xcodebuild prints it
+	lines := []string{`error: No profiles for 'com.example.app' were found`}
+	for i := 0; i < 150; i++ {
+		lines = append(lines, "    cd /app/ios && /usr/bin/clang -x objective-c ...")
+	}
+	tail := newLineTail(stdoutTailLines)
+	for _, line := range lines {
+		tail.Add(line)
+	}
+	err := classifyXcodebuildError(&CommandError{StdoutTail: tail.Lines(), Err: errors.New("exit status 65")}, "archive")
+	if !strings.Contains(err.Error(), "provisioning profile") {
+		t.Errorf("error on stdout %d lines before the end was missed: %v", len(lines)-1, err)
+	}
+}
@@ -4,21 +4,41 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	RootPath          string `yaml:"root_path"`
 	BuildVersion      string `yaml:"build_version"`
+	VersionSource     string `yaml:"version_source"`      // Optional: config (default), auto, app.json, app.config or package.json
+	WriteVersion      bool   `yaml:"write_version"`       // Write the build version back to app.json / package.json
+	BuildNumberScheme string `yaml:"build_number_scheme"` // patch (default) or semver (needed for pre-releases like -rc.1)
+	TagOnSuccess      bool   `yaml:"tag_on_success"`      // Create a v<version> git tag after a successful build
+	DirtyTree         string `yaml:"dirty_tree"`          // Uncommitted changes before a build: warn (default), refuse or ignore
 	Platform          string `yaml:"platform"`
+	FailFast          bool   `yaml:"fail_fast"` // With platform all, stop the other platform's build when one fails
+	Ref               string `yaml:"ref"`       // Optional: branch, tag or SHA to build in a temporary git worktree
+	Branch            string `yaml:"branch"`    // Optional: branch whose environment to build (default: resolved from ref, CI or git)
 	DriveFolderID     string `yaml:"drive_folder_id"`
 	SkipUpload        bool   `yaml:"skip_upload"`
 	SkipDeps          bool   `yaml:"skip_deps"`
+	ForceReinstall    bool   `yaml:"force_reinstall"`    // Reinstall dependencies even if lockfiles are unchanged
+	PackageManager    string `yaml:"package_manager"`    // Optional: npm, yarn, pnpm or bun (default: auto-detect)
+	ProjectType       string `yaml:"project_type"`       // Optional: expo or bare (default: auto-detect from package.json and app config)
+	CleanPrebuild     bool   `yaml:"clean_prebuild"`     // Pass --clean to expo prebuild (regenerates android/ and ios/)
 	AppleID           string `yaml:"apple_id"`           // For TestFlight upload
 	TeamID            string `yaml:"team_id"`            // For TestFlight upload (non-main/provider)
 	ReleaseChannel    string `yaml:"release_channel"`    // Keep if used by expo prebuild or other logic
 	GoogleCredentials string `yaml:"google_credentials"` // Path to credentials file
-	Android           struct {
+	DiagnosisRules    string `yaml:"diagnosis_rules"`    // Optional: YAML file with extra known-failure rules
+	JSONLogs          bool   `yaml:"json_logs"`          // Also write a JSON-lines log next to the text log
+	LogDir            string `yaml:"log_dir"`            // Optional: where run folders go (default: OS user data dir)
+	LogRetention      struct {
+		MaxRuns    int `yaml:"max_runs"`     // Run folders to keep (0 = default 50, negative = unlimited)
+		MaxAgeDays int `yaml:"max_age_days"` // Delete run folders older than this (0 = default 30, negative = never)
+	} `yaml:"log_retention"`
+	Android struct {
 		BuildType string `yaml:"build_type"` // e.g., "Release", "Debug", or flavor like "ProductionRelease"
 		// Add flavor if needed: Flavor string `yaml:"flavor"`
 	} `yaml:"android"`
@@ -27,6 +47,13 @@ type Config struct {
 		Scheme      string `yaml:"scheme"`       // Optional: Override auto-detected scheme
 		ProjectName string `yaml:"project_name"` // Optional: Override auto-detected workspace/project name
 	} `yaml:"ios"`
+	AppStoreConnect AppStoreConnectConfig `yaml:"app_store_connect"` // API key for setting TestFlight's What to Test
+	Notifications   []NotifierConfig      `yaml:"notifications"`     // Webhooks told about build start, success and failure
+	Queue           QueueLimits           `yaml:"queue"`             // Concurrent builds per platform in the GUI and serve queues
+	Watch           WatchConfig           `yaml:"watch"`             // Branches rn-builder watch builds when new commits are pushed
+	Schedules       []ScheduleConfig      `yaml:"schedules"`         // Builds serve and watch start on a cron schedule
+
+	Trigger string `yaml:"-"` // What started the build (see BuildRequest.Trigger); recorded in the run manifest
 }
 
 // SaveConfig saves the configuration to a YAML file
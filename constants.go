@@ -9,6 +9,7 @@ const (
 	googleDriveUploadScope       = "https://www.googleapis.com/auth/drive.file"
 	googleDriveUploadURL         = "https://www.googleapis.com/upload/drive/v3/files?uploadType=multipart"
 	googleDriveMetadataURL       = "https://www.googleapis.com/drive/v3/files"
+	googleDriveFileViewURL       = "https://drive.google.com/file/d/%s/view"
 	exportOptionsAppStorePlist   = "ExportOptionsAppStore.plist"   // Assumed name for App Store plist
 	exportOptionsEnterprisePlist = "ExportOptionsEnterprise.plist" // Assumed name for Enterprise plist
 )
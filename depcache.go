@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dependency groups tracked in the state file
+const (
+	depGroupJS   = "js"
+	depGroupPods = "pods"
+)
+
+// depStamp records the inputs of the last successful install of a dependency group
+type depStamp struct {
+	Inputs      map[string]string `json:"inputs"`
+	InstalledAt time.Time         `json:"installed_at"`
+}
+
+// depCache is the per-project install state, stored in the user data dir so the
+// project's working tree is never touched
+type depCache struct {
+	path        string
+	RootPath    string               `json:"root_path"`
+	Stamps      map[string]*depStamp `json:"stamps"`
+	nodeVersion string
+}
+
+// hashFile returns the hex SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// projectKey returns a short stable key for a project, derived from its absolute root path
+func projectKey(rootPath string) (string, error) {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve root path: %w", err)
+	}
+	key := sha256.Sum256([]byte(absRoot))
+	return fmt.Sprintf("%x", key[:8]), nil
+}
+
+// depStatePath returns the state file for a project, keyed on its absolute root path
+func depStatePath(rootPath string) (string, error) {
+	key, err := projectKey(rootPath)
+	if err != nil {
+		return "", err
+	}
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "state", "deps-"+key+".json"), nil
+}
+
+// loadDepCache reads the install state for a project; a missing or unreadable
+// state file just means every install will run
+func loadDepCache(rootPath string, logOutput io.Writer) *depCache {
+	cache := &depCache{RootPath: rootPath, Stamps: make(map[string]*depStamp)}
+
+	path, err := depStatePath(rootPath)
+	if err != nil {
+		fmt.Fprintf(logOutput, "Warning: dependency cache disabled: %v\n", err)
+		return cache
+	}
+	cache.path = path
+
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, cache); err != nil {
+			fmt.Fprintf(logOutput, "Warning: ignoring corrupt dependency state file %s: %v\n", path, err)
+			cache.Stamps = make(map[string]*depStamp)
+		}
+		if cache.Stamps == nil {
+			cache.Stamps = make(map[string]*depStamp)
+		}
+	}
+
+	if version, err := runCmdOutput(rootPath, "node", "--version"); err == nil {
+		cache.nodeVersion = version
+	} else {
+		fmt.Fprintf(logOutput, "Warning: could not determine node version: %v\n", err)
+	}
+	return cache
+}
+
+// fileInput hashes a file for use as a cache input ("missing" if it does not exist)
+func fileInput(path string) string {
+	hash, err := hashFile(path)
+	if err != nil {
+		return "missing"
+	}
+	return hash
+}
+
+// decide reports whether a group needs installing and why. installedOK is false when
+// the install output (node_modules, Pods) is missing regardless of the recorded inputs.
+func (c *depCache) decide(group string, inputs map[string]string, installedOK bool, force bool) (bool, string) {
+	if force {
+		return true, "force reinstall requested"
+	}
+	if c.path == "" {
+		return true, "dependency cache unavailable"
+	}
+	if !installedOK {
+		return true, "installed dependencies are missing"
+	}
+	stamp := c.Stamps[group]
+	if stamp == nil {
+		return true, "no previous install recorded"
+	}
+	if inputs["node"] == "" {
+		return true, "node version unknown"
+	}
+
+	var changed []string
+	for key, value := range inputs {
+		if stamp.Inputs[key] != value {
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		return true, "changed since last install: " + strings.Join(changed, ", ")
+	}
+	return false, fmt.Sprintf("inputs unchanged since last install at %s", stamp.InstalledAt.Format("2006-01-02 15:04"))
+}
+
+// record stores the inputs of a successful install and saves the state file
+func (c *depCache) record(group string, inputs map[string]string) error {
+	if c.path == "" {
+		return nil
+	}
+	c.Stamps[group] = &depStamp{Inputs: inputs, InstalledAt: time.Now()}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dependency state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write dependency state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDepCacheDecide(t *testing.T) {
+	recorded := map[string]string{"package_manager": "yarn", "lockfile": "yarn.lock:abc", "node": "v20.11.0"}
+	with := func(key, value string) map[string]string {
+		inputs := map[string]string{}
+		for k, v := range recorded {
+			inputs[k] = v
+		}
+		inputs[key] = value
+		return inputs
+	}
+	tests := []struct {
+		name        string
+		inputs      map[string]string
+		installedOK bool
+		force       bool
+		noState     bool // Cache has no state file path
+		group       string
+		wantInstall bool
+		wantReason  string
+	}{
+		{name: "unchanged", inputs: recorded, installedOK: true, wantReason: "inputs unchanged"},
+		{name: "changed lockfile", inputs: with("lockfile", "yarn.lock:def"), installedOK: true, wantInstall: true, wantReason: "changed since last install: lockfile"},
+		{name: "changed node version", inputs: with("node", "v22.1.0"), installedOK: true, wantInstall: true, wantReason: "changed since last install: node"},
+		{name: "changed package manager and lockfile", inputs: map[string]string{"package_manager": "npm", "lockfile": "package-lock.json:abc", "node": "v20.11.0"}, installedOK: true, wantInstall: true, wantReason: "lockfile, package_manager"},
+		{name: "new input", inputs: with("podfile", "123"), installedOK: true, wantInstall: true, wantReason: "podfile"},
+		{name: "missing node_modules or Manifest.lock", inputs: recorded, installedOK: false, wantInstall: true, wantReason: "installed dependencies are missing"},
+		{name: "force reinstall", inputs: recorded, installedOK: true, force: true, wantInstall: true, wantReason: "force reinstall"},
+		{name: "unknown node version", inputs: with("node", ""), installedOK: true, wantInstall: true, wantReason: "node version unknown"},
+		{name: "no previous install", inputs: recorded, installedOK: true, group: depGroupPods, wantInstall: true, wantReason: "no previous install"},
+		{name: "no state file", inputs: recorded, installedOK: true, noState: true, wantInstall: true, wantReason: "cache unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &depCache{path: "deps.json", Stamps: map[string]*depStamp{depGroupJS: {Inputs: recorded}}}
+			if tt.noState {
+				cache.path = ""
+			}
+			group := depGroupJS
+			if tt.group != "" {
+				group = tt.group
+			}
+			install, reason := cache.decide(group, tt.inputs, tt.installedOK, tt.force)
+			if install != tt.wantInstall || !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("decide = %v (%s), want %v (%s)", install, reason, tt.wantInstall, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestDepCacheRecordIsReloaded(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", "")
+	root := t.TempDir()
+	lock := filepath.Join(root, "yarn.lock")
+	if err := os.WriteFile(lock, []byte("# yarn lockfile v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inputs := func() map[string]string {
+		return map[string]string{"lockfile": "yarn.lock:" + fileInput(lock), "node": "v20.11.0"}
+	}
+
+	cache := loadDepCache(root, io.Discard)
+	if install, _ := cache.decide(depGroupJS, inputs(), true, false); !install {
+		t.Fatal("first build skipped the install")
+	}
+	if err := cache.record(depGroupJS, inputs()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next build sees the recorded install
+	if install, reason := loadDepCache(root, io.Discard).decide(depGroupJS, inputs(), true, false); install {
+		t.Errorf("unchanged inputs reinstalled: %s", reason)
+	}
+	if err := os.WriteFile(lock, []byte("# yarn lockfile v1\nreact@18\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if install, reason := loadDepCache(root, io.Discard).decide(depGroupJS, inputs(), true, false); !install || !strings.Contains(reason, "lockfile") {
+		t.Errorf("edited lockfile: decide = %v (%s)", install, reason)
+	}
+	if got := fileInput(filepath.Join(root, "missing.lock")); got != "missing" {
+		t.Errorf("fileInput of a missing file = %q", got)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DiagnosisRule maps a known failure signature in the build output to an explanation and fix
+type DiagnosisRule struct {
+	Name        string `yaml:"name"`
+	Pattern     string `yaml:"pattern"` // Go regular expression matched against each output line
+	Explanation string `yaml:"explanation"`
+	Fix         string `yaml:"fix"`
+
+	re *regexp.Regexp
+}
+
+// Diagnosis is a rule that matched, together with the first line that triggered it
+type Diagnosis struct {
+	Rule DiagnosisRule
+	Line string
+}
+
+// builtinDiagnosisRules covers the failures we see most often on build machines
+var builtinDiagnosisRules = []DiagnosisRule{
+	{
+		Name:        "android-sdk-licences",
+		Pattern:     `(?i)licen[cs]es? (for .* )?(have|has) not been accepted`,
+		Explanation: "The Android SDK licences have not been accepted on this machine.",
+		Fix:         "Run 'sdkmanager --licenses' (or '$ANDROID_HOME/cmdline-tools/latest/bin/sdkmanager --licenses') and accept all licences.",
+	},
+	{
+		Name:        "android-sdk-missing",
+		Pattern:     `(?i)SDK location not found`,
+		Explanation: "Gradle could not locate the Android SDK.",
+		Fix:         "Set ANDROID_HOME, or add sdk.dir=/path/to/Android/sdk to android/local.properties.",
+	},
+	{
+		Name:        "java-version",
+		Pattern:     `(?i)(Unsupported class file major version|Android Gradle plugin requires Java \d+|incompatible (with )?Java|Could not determine java version)`,
+		Explanation: "Gradle is running with a Java version the Android Gradle plugin does not support.",
+		Fix:         "Install the required JDK (usually 17) and point JAVA_HOME at it before building.",
+	},
+	{
+		Name:        "metro-port-in-use",
+		Pattern:     `(?i)(EADDRINUSE.*8081|port 8081 (is )?(already )?in use)`,
+		Explanation: "Another Metro bundler (or other process) is already listening on port 8081.",
+		Fix:         "Stop the other Metro instance ('lsof -i :8081' to find it) or set RCT_METRO_PORT to a free port.",
+	},
+	{
+		Name:        "cocoapods-repo-outdated",
+		Pattern:     `(?i)(CocoaPods could not find compatible versions for pod|out-of-date source repos|Unable to find a specification for)`,
+		Explanation: "The local CocoaPods spec repo is older than the versions the Podfile asks for.",
+		Fix:         "Run 'pod install --repo-update' (or 'pod repo update') in the ios directory.",
+	},
+	{
+		Name:        "cocoapods-out-of-sync",
+		Pattern:     `The sandbox is not in sync with the Podfile\.lock`,
+		Explanation: "The installed Pods do not match Podfile.lock.",
+		Fix:         "Run 'pod install' in the ios directory, or untick 'Skip Dependencies'.",
+	},
+	{
+		Name:        "signing-identity-missing",
+		Pattern:     `(?i)(No signing certificate|no identity found|signing identity .* (could not be found|not found)|No certificate for team)`,
+		Explanation: "Xcode could not find the code signing certificate required for this build.",
+		Fix:         "Install the distribution certificate (with its private key) into the login keychain, or check team_id.",
+	},
+	{
+		Name:        "provisioning-profile-missing",
+		Pattern:     `(?i)(No profiles for '.*' were found|requires a provisioning profile)`,
+		Explanation: "No provisioning profile matches the bundle identifier and signing settings.",
+		Fix:         "Download the profile in Xcode (Settings > Accounts) or enable automatic signing for the target.",
+	},
+	{
+		Name:        "disk-full",
+		Pattern:     `(?i)(No space left on device|ENOSPC|There is not enough space on the disk)`,
+		Explanation: "The build machine ran out of disk space.",
+		Fix:         "Free space, e.g. delete ~/Library/Developer/Xcode/DerivedData, old archives, ~/.gradle/caches and dist/ output.",
+	},
+	{
+		Name:        "gradle-out-of-memory",
+		Pattern:     `(?i)(java\.lang\.OutOfMemoryError|Java heap space|Metaspace)`,
+		Explanation: "The Gradle daemon ran out of memory.",
+		Fix:         "Raise org.gradle.jvmargs (e.g. -Xmx4g -XX:MaxMetaspaceSize=1g) in android/gradle.properties.",
+	},
+	{
+		Name:        "node-engine-mismatch",
+		Pattern:     `(?i)(The engine "node" is incompatible|Unsupported engine)`,
+		Explanation: "The installed Node.js version does not satisfy the project's engines requirement.",
+		Fix:         "Switch to the Node version in .nvmrc / package.json engines (e.g. 'nvm use').",
+	},
+}
+
+// compileDiagnosisRules validates and compiles the patterns of the given rules; a rule
+// without a name is named after its pattern
+func compileDiagnosisRules(rules []DiagnosisRule) ([]DiagnosisRule, error) {
+	compiled := make([]DiagnosisRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = rule.Pattern // Matches are reported once per name
+		}
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("diagnosis rule '%s' has no pattern", rule.Name)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for diagnosis rule '%s': %w", rule.Name, err)
+		}
+		rule.re = re
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+// loadDiagnosisRules returns the built-in rules, preceded by user rules from rulesPath (if set)
+func loadDiagnosisRules(rulesPath string) ([]DiagnosisRule, error) {
+	rules := []DiagnosisRule{}
+	if rulesPath != "" {
+		data, err := os.ReadFile(rulesPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read diagnosis rules file: %w", err)
+		}
+		var file struct {
+			Rules []DiagnosisRule `yaml:"rules"`
+		}
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse diagnosis rules file: %w", err)
+		}
+		rules = append(rules, file.Rules...) // User rules win over built-in ones
+	}
+	rules = append(rules, builtinDiagnosisRules...)
+	return compileDiagnosisRules(rules)
+}
+
+// Diagnoser is a LogSink that scans build output line by line for known failures
+type Diagnoser struct {
+	mu      sync.Mutex
+	rules   []DiagnosisRule
+	matches []Diagnosis
+	seen    map[string]bool
+}
+
+// NewDiagnoser creates a Diagnoser for the given (compiled) rules
+func NewDiagnoser(rules []DiagnosisRule) *Diagnoser {
+	return &Diagnoser{rules: rules, seen: make(map[string]bool)}
+}
+
+// WriteRecord matches a log line against the rules
+func (d *Diagnoser) WriteRecord(rec LogRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, rule := range d.rules {
+		if d.seen[rule.Name] || !rule.re.MatchString(rec.Message) {
+			continue
+		}
+		d.seen[rule.Name] = true
+		d.matches = append(d.matches, Diagnosis{Rule: rule, Line: strings.TrimSpace(rec.Message)})
+	}
+}
+
+// Diagnoses returns the matched rules in the order they were first seen
+func (d *Diagnoser) Diagnoses() []Diagnosis {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Diagnosis(nil), d.matches...)
+}
+
+// DiagnosedError wraps a build error with the known failures found in its output
+type DiagnosedError struct {
+	Err       error
+	Diagnoses []Diagnosis
+}
+
+func (e *DiagnosedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DiagnosedError) Unwrap() error {
+	return e.Err
+}
+
+// diagnosesFromError extracts the diagnoses attached to err, if any
+func diagnosesFromError(err error) []Diagnosis {
+	var diagErr *DiagnosedError
+	if errors.As(err, &diagErr) {
+		return diagErr.Diagnoses
+	}
+	return nil
+}
+
+// formatDiagnoses renders diagnoses as a human-readable "Likely cause" summary
+func formatDiagnoses(diagnoses []Diagnosis) string {
+	var sb strings.Builder
+	for i, d := range diagnoses {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s\n  Fix: %s\n  Matched: %s\n", d.Rule.Explanation, d.Rule.Fix, d.Line)
+	}
+	return sb.String()
+}
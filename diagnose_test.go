@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnoserUserRules(t *testing.T) {
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	rules := `rules:
+  - pattern: "Could not resolve host"
+    explanation: "No network."
+  - pattern: "EACCES"
+    explanation: "Permission denied."
+  - name: "gradle-out-of-memory"
+    pattern: "custom out of memory message"
+    explanation: "Overrides the built-in rule."
+`
+	if err := os.WriteFile(rulesPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadDiagnosisRules(rulesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDiagnoser(loaded)
+	for _, line := range []string{
+		"curl: (6) Could not resolve host: registry.npmjs.org",
+		"npm ERR! code EACCES",
+		"npm ERR! code EACCES", // Reported once
+		"custom out of memory message",
+	} {
+		d.WriteRecord(LogRecord{Message: line})
+	}
+
+	// Unnamed rules are told apart by their pattern, so each one is reported
+	got := d.Diagnoses()
+	var names []string
+	for _, diag := range got {
+		names = append(names, diag.Rule.Name)
+	}
+	want := []string{"Could not resolve host", "EACCES", "gradle-out-of-memory"}
+	if len(names) != len(want) {
+		t.Fatalf("diagnoses = %q, want %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("diagnoses = %q, want %q", names, want)
+			break
+		}
+	}
+
+	if _, err := compileDiagnosisRules([]DiagnosisRule{{Name: "empty"}}); err == nil {
+		t.Error("rule without a pattern accepted")
+	}
+	if _, err := compileDiagnosisRules([]DiagnosisRule{{Pattern: "("}}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSMTPPort  = 587
+	smtpsPort        = 465 // Implicit TLS instead of STARTTLS
+	emailLogTailName = "build-log-tail.txt"
+)
+
+// emailNotifier sends a summary email through an SMTP server
+type emailNotifier struct {
+	notifierFilter
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// newEmailNotifier validates the SMTP settings of one email profile
+func newEmailNotifier(c NotifierConfig, filter notifierFilter) (*emailNotifier, error) {
+	if c.Host == "" {
+		return nil, errors.New("host is required for email")
+	}
+	if len(c.To) == 0 {
+		return nil, errors.New("at least one recipient (to) is required for email")
+	}
+	from := c.From
+	if from == "" {
+		from = c.Username
+	}
+	if _, err := mail.ParseAddress(os.ExpandEnv(from)); err != nil {
+		return nil, fmt.Errorf("invalid from address '%s': %w", from, err)
+	}
+	for _, to := range c.To {
+		if _, err := mail.ParseAddress(os.ExpandEnv(to)); err != nil {
+			return nil, fmt.Errorf("invalid recipient '%s': %w", to, err)
+		}
+	}
+	port := c.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	return &emailNotifier{
+		notifierFilter: filter,
+		host:           c.Host,
+		port:           port,
+		username:       c.Username,
+		password:       c.Password,
+		from:           from,
+		to:             c.To,
+	}, nil
+}
+
+func (n *emailNotifier) Name() string { return "email" }
+
+func (n *emailNotifier) Notify(ctx context.Context, e BuildEvent) error {
+	from, _ := mail.ParseAddress(os.ExpandEnv(n.from))
+	var to []string
+	for _, addr := range n.to {
+		parsed, _ := mail.ParseAddress(os.ExpandEnv(addr))
+		to = append(to, parsed.Address)
+	}
+	msg, err := buildEmailMessage(from.String(), to, e)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	return n.send(ctx, from.Address, to, msg)
+}
+
+// send delivers msg over SMTP, upgrading to TLS when the server offers it
+func (n *emailNotifier) send(ctx context.Context, from string, to []string, msg []byte) error {
+	addr := net.JoinHostPort(n.host, strconv.Itoa(n.port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: n.host}
+	if n.port == smtpsPort {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake with %s failed: %w", addr, err)
+	}
+	defer client.Close()
+
+	if n.port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		}
+	}
+	if n.username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("SMTP server does not support authentication")
+		}
+		// PlainAuth refuses to send credentials over an unencrypted connection to a remote host
+		auth := smtp.PlainAuth("", os.ExpandEnv(n.username), os.ExpandEnv(n.password), n.host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("SMTP server rejected sender %s: %w", from, err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP server rejected recipient %s: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send email body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected the email: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildEmailMessage renders the MIME message: text and HTML alternatives, plus the log
+// tail as an attachment for failures
+func buildEmailMessage(from string, to []string, e BuildEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	header.Set("To", strings.Join(to, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", eventTitle(e)))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("MIME-Version", "1.0")
+
+	mixed := multipart.NewWriter(&buf)
+	header.Set("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	writeMIMEHeader(&buf, header)
+
+	alternative := &bytes.Buffer{}
+	altWriter := multipart.NewWriter(alternative)
+	htmlBody, err := emailHTML(e)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", emailText(e)},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		w, err := altWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.body))
+		qp.Close()
+	}
+	altWriter.Close()
+
+	w, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + altWriter.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.Write(alternative.Bytes())
+
+	if len(e.LogTail) > 0 {
+		w, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", emailLogTailName)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(w, []byte(strings.Join(e.LogTail, "\r\n")+"\r\n"))
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMIMEHeader writes header fields in a stable order followed by the blank line
+func writeMIMEHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, key := range []string{"From", "To", "Subject", "Date", "MIME-Version", "Content-Type"} {
+		fmt.Fprintf(buf, "%s: %s\r\n", key, header.Get(key))
+	}
+	buf.WriteString("\r\n")
+}
+
+// writeBase64Lines writes data base64-encoded in 76 character lines, as MIME requires
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+// emailText is the plain-text body
+func emailText(e BuildEvent) string {
+	var b strings.Builder
+	b.WriteString(eventTitle(e) + "\n\n")
+	for _, f := range eventFacts(e) {
+		fmt.Fprintf(&b, "%s: %s\n", f[0], f[1])
+	}
+	if e.Manifest.Error != "" {
+		fmt.Fprintf(&b, "\nReason: %s\n", e.Manifest.Error)
+	}
+	for _, cause := range e.Manifest.LikelyCauses {
+		fmt.Fprintf(&b, "Likely cause: %s\n", cause)
+	}
+	if artifacts := eventArtifacts(e); len(artifacts) > 0 && e.Event == eventSuccess {
+		b.WriteString("\nDownloads:\n")
+		for _, a := range artifacts {
+			fmt.Fprintf(&b, "  %s\n", a)
+		}
+	}
+	if notes := eventNotes(e); notes != "" && e.Event == eventSuccess {
+		fmt.Fprintf(&b, "\nWhat's new:\n%s\n", notes)
+	}
+	if len(e.LogTail) > 0 {
+		fmt.Fprintf(&b, "\nThe last %d log lines are attached (%s).\n", len(e.LogTail), emailLogTailName)
+	}
+	return b.String()
+}
+
+var emailHTMLTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif">
+<h2 style="color: {{.Color}}">{{.Title}}</h2>
+<table cellpadding="4">{{range .Facts}}
+<tr><td><b>{{index . 0}}</b></td><td>{{index . 1}}</td></tr>{{end}}
+</table>
+{{if .Error}}<h3>Reason</h3><pre>{{.Error}}</pre>{{end}}
+{{range .Causes}}<p><b>Likely cause:</b> {{.}}</p>{{end}}
+{{if .Links}}<h3>Downloads</h3><ul>{{range .Links}}<li><a href="{{.}}">{{.}}</a></li>{{end}}</ul>{{end}}
+{{if .Notes}}<h3>What's new</h3><pre>{{.Notes}}</pre>{{end}}
+{{if .LogLines}}<p>The last {{.LogLines}} log lines are attached.</p>{{end}}
+</body></html>
+`))
+
+// emailHTML is the HTML body; download links are only rendered for uploaded artifacts
+func emailHTML(e BuildEvent) (string, error) {
+	data := struct {
+		Title, Color, Error, Notes string
+		Facts                      [][2]string
+		Causes, Links              []string
+		LogLines                   int
+	}{
+		Title:    eventTitle(e),
+		Color:    "#2e7d32",
+		Error:    e.Manifest.Error,
+		Facts:    eventFacts(e),
+		Causes:   e.Manifest.LikelyCauses,
+		LogLines: len(e.LogTail),
+	}
+	if e.Event == eventFailure {
+		data.Color = "#c62828"
+	}
+	if e.Event == eventSuccess {
+		data.Links = e.Manifest.ArtifactLinks
+		data.Notes = eventNotes(e)
+	}
+	var b strings.Builder
+	if err := emailHTMLTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render email: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn accepts one SMTP session on localhost and returns the DATA it received
+func smtpStandIn(t *testing.T) (port int, data <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost test SMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+			switch verb {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250-localhost\r\n250 8BITMIME") // No STARTTLS or AUTH
+			case "MAIL", "RCPT", "RSET", "NOOP":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				body, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- string(body)
+				tp.PrintfLine("250 OK: queued")
+			case "QUIT":
+				tp.PrintfLine("221 Bye")
+				return
+			default:
+				tp.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+// sendTestEmail sends e through a fresh SMTP stand-in and returns the message it captured
+func sendTestEmail(t *testing.T, e BuildEvent) *mail.Message {
+	t.Helper()
+	port, data := smtpStandIn(t)
+	n, err := newEmailNotifier(NotifierConfig{
+		Type: notifierEmail,
+		Host: "127.0.0.1",
+		Port: port,
+		From: "rn-builder <builds@example.com>",
+		To:   []string{"qa@example.com"},
+	}, notifierFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case raw := <-data:
+		msg, err := mail.ReadMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP stand-in received no DATA")
+		return nil
+	}
+}
+
+// emailPart is one leaf of a MIME message, with its transfer encoding undone
+type emailPart struct {
+	contentType string
+	filename    string
+	body        string
+}
+
+// emailParts flattens the multipart tree of a message
+func emailParts(t *testing.T, contentType string, body io.Reader) []emailPart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		data, _ := io.ReadAll(body)
+		return []emailPart{{contentType: mediaType, body: string(data)}}
+	}
+	var parts []emailPart
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart() // Undoes quoted-printable
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+			if err != nil {
+				t.Fatal(err)
+			}
+			mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			parts = append(parts, emailPart{contentType: mediaType, filename: part.FileName(), body: string(data)})
+			continue
+		}
+		parts = append(parts, emailParts(t, part.Header.Get("Content-Type"), part)...)
+	}
+}
+
+func TestEmailSuccess(t *testing.T) {
+	e := testEvent(eventSuccess)
+	e.Manifest.ArtifactLinks = append(e.Manifest.ArtifactLinks, "https://drive.google.com/file/d/def456/view")
+	msg := sendTestEmail(t, e)
+
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != "Build succeeded: android 1.4.2" {
+		t.Errorf("subject = %q", subject)
+	}
+	if to := msg.Header.Get("To"); to != "qa@example.com" {
+		t.Errorf("to = %q", to)
+	}
+	parts := emailParts(t, msg.Header.Get("Content-Type"), msg.Body)
+	var types []string
+	for _, p := range parts {
+		types = append(types, p.contentType)
+	}
+	if !slices.Equal(types, []string{"text/plain", "text/html"}) {
+		t.Fatalf("parts = %q, want text and HTML alternatives only", types)
+	}
+	for _, link := range e.Manifest.ArtifactLinks {
+		if !strings.Contains(parts[0].body, link) {
+			t.Errorf("text part lacks %s:\n%s", link, parts[0].body)
+		}
+		if !strings.Contains(parts[1].body, fmt.Sprintf(`<a href="%s">`, link)) {
+			t.Errorf("HTML part lacks a link to %s:\n%s", link, parts[1].body)
+		}
+	}
+	for _, want := range []string{"1.4.2", "STAGING", "2m5s"} {
+		if !strings.Contains(parts[0].body, want) || !strings.Contains(parts[1].body, want) {
+			t.Errorf("email lacks %q", want)
+		}
+	}
+}
+
+func TestEmailFailureAttachesLogTail(t *testing.T) {
+	lw, err := NewLogWriter(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lw.Close()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var lines []string
+	for i := range 500 {
+		rec := LogRecord{Time: start.Add(time.Duration(i) * time.Second), Step: "gradle", Message: fmt.Sprintf("line %d", i)}
+		lw.WriteRecord(rec)
+		lines = append(lines, formatLogRecord(rec))
+	}
+	tail, err := lw.Tail(notifyLogTailLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := testEvent(eventFailure)
+	e.LogTail = tail
+	msg := sendTestEmail(t, e)
+	parts := emailParts(t, msg.Header.Get("Content-Type"), msg.Body)
+	if len(parts) != 3 || parts[2].filename != emailLogTailName {
+		t.Fatalf("parts = %+v, want text, HTML and %s", parts, emailLogTailName)
+	}
+	if !strings.Contains(parts[0].body, "gradle build failed: exit status 1") {
+		t.Errorf("text part lacks the failure reason:\n%s", parts[0].body)
+	}
+	attached := strings.Split(strings.TrimSuffix(parts[2].body, "\r\n"), "\r\n")
+	if want := lines[len(lines)-notifyLogTailLines:]; !slices.Equal(attached, want) {
+		t.Errorf("attachment has %d lines from %q to %q, want the last %d (%q to %q)",
+			len(attached), attached[0], attached[len(attached)-1], len(want), want[0], want[len(want)-1])
+	}
+}
+
+func TestLogWriterTail(t *testing.T) {
+	lw, err := NewLogWriter(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lw.Close()
+	write := func(from, to int) {
+		for i := from; i < to; i++ {
+			lw.WriteRecord(LogRecord{Message: fmt.Sprint(i)})
+		}
+	}
+	tail := func(n int) []string {
+		t.Helper()
+		lines, err := lw.Tail(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var messages []string
+		for _, line := range lines {
+			_, msg, _ := strings.Cut(line, " ") // Drop the timestamp
+			messages = append(messages, msg)
+		}
+		return messages
+	}
+
+	if got := tail(5); len(got) != 0 {
+		t.Errorf("empty log: Tail = %q", got)
+	}
+	write(0, 3)
+	if got := tail(5); !slices.Equal(got, []string{"0", "1", "2"}) {
+		t.Errorf("fewer lines than n: Tail = %q", got)
+	}
+	if got := tail(3); !slices.Equal(got, []string{"0", "1", "2"}) {
+		t.Errorf("exactly n lines: Tail = %q", got)
+	}
+	write(3, 8) // 8 lines: the ring of 3 wraps twice, ending mid-buffer
+	if got := tail(3); !slices.Equal(got, []string{"5", "6", "7"}) {
+		t.Errorf("wrapped ring: Tail = %q", got)
+	}
+	write(8, 9) // 9 lines: the ring ends exactly at its start
+	if got := tail(3); !slices.Equal(got, []string{"6", "7", "8"}) {
+		t.Errorf("wrapped ring at a boundary: Tail = %q", got)
+	}
+	if got := tail(0); got != nil {
+		t.Errorf("Tail(0) = %q", got)
+	}
+}
+
+func TestLogWriterTailLongLines(t *testing.T) {
+	lw, err := NewLogWriter(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lw.Close()
+	long := strings.Repeat("x", bufio.MaxScanTokenSize*2) // Beyond the scanner's default buffer
+	lw.WriteRecord(LogRecord{Message: long})
+	lw.WriteRecord(LogRecord{Message: "after"})
+	lines, err := lw.Tail(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], long) || !strings.HasSuffix(lines[1], "after") {
+		t.Errorf("Tail lost the long line: got %d lines", len(lines))
+	}
+}
@@ -1,126 +1,118 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
-	"time"
-
-	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/container"
-	"fyne.io/fyne/v2/widget"
 )
 
-var logBuffer bytes.Buffer         // Buffer to store logs before processing into lines
-var logWriter *LogWriter           // Our thread-safe writer wrapper
-var logEntry *widget.Entry         // The GUI text area for logs
-var logContainer *container.Scroll // The scroll container holding the logEntry
-var lines []string                 // Slice to hold the lines currently displayed (limited size)
-const maxLogLines = 25             // Define the maximum number of lines to keep
-
-// LogWriter is a thread-safe writer for updating both file and GUI log
+// LogWriter is a thread-safe LogSink that writes a run's human-readable log file
+// and, optionally, a JSON-lines file next to it
 type LogWriter struct {
 	mu       sync.Mutex
 	file     *os.File
+	jsonFile *os.File
+	json     *jsonLinesSink
 	logDir   string
 	filename string
 }
 
-// NewLogWriter creates a new LogWriter that writes to both file and GUI
-func NewLogWriter() (*LogWriter, error) {
-	// Create logs directory if it doesn't exist
-	logDir := "logs"
-	if err := os.MkdirAll(logDir, 0755); err != nil {
+// NewLogWriter creates build.log (and build.jsonl if jsonEnabled) in runDir
+func NewLogWriter(runDir string, jsonEnabled bool) (*LogWriter, error) {
+	// Create the run directory if it doesn't exist
+	if err := os.MkdirAll(runDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create logs directory: %w", err)
 	}
 
-	// Create log file with timestamp
-	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	filename := fmt.Sprintf("build_%s.log", timestamp)
-	filepath := filepath.Join(logDir, filename)
-
-	file, err := os.Create(filepath)
+	file, err := os.Create(filepath.Join(runDir, runLogFile))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create log file: %w", err)
 	}
 
-	// Initialize lines slice if it's nil
-	if lines == nil {
-		lines = make([]string, 0, maxLogLines)
-	}
-
-	return &LogWriter{
+	lw := &LogWriter{
 		file:     file,
-		logDir:   logDir,
-		filename: filename,
-	}, nil
+		logDir:   runDir,
+		filename: runLogFile,
+	}
+	if jsonEnabled {
+		jsonFile, err := os.Create(filepath.Join(runDir, runJSONLogFile))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create JSON log file: %w", err)
+		}
+		lw.jsonFile = jsonFile
+		lw.json = &jsonLinesSink{w: jsonFile}
+	}
+	return lw, nil
 }
 
-// Write processes incoming byte slices, writes to file and updates GUI
-func (lw *LogWriter) Write(p []byte) (n int, err error) {
+// WriteRecord writes a record to the log file(s)
+func (lw *LogWriter) WriteRecord(rec LogRecord) {
 	lw.mu.Lock()
 	defer lw.mu.Unlock()
 
-	// Write to file first
-	if n, err = lw.file.Write(p); err != nil {
-		return n, fmt.Errorf("failed to write to log file: %w", err)
+	if lw.file == nil {
+		return // Already closed
 	}
-	lw.file.Sync() // Ensure it's written to disk
-
-	// Add incoming data to the GUI buffer
-	originalLen := len(p)
-	if _, err = logBuffer.Write(p); err != nil {
-		return originalLen, nil // Continue even if GUI buffer fails
+	fmt.Fprintln(lw.file, formatLogRecord(rec))
+	if lw.json != nil {
+		lw.json.WriteRecord(rec)
 	}
+}
 
-	// Process full lines from the buffer for GUI
-	linesAdded := false
-	for {
-		line, err := logBuffer.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			break
-		}
-
-		linesAdded = true
-		processedLine := strings.TrimRight(line, "\r\n")
+// Path returns the path of the log file being written
+func (lw *LogWriter) Path() string {
+	return filepath.Join(lw.logDir, lw.filename)
+}
 
-		lines = append(lines, processedLine)
-		if len(lines) > maxLogLines {
-			lines = lines[1:]
-		}
+// Tail returns the last n lines of the log file written so far
+func (lw *LogWriter) Tail(n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
 	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
 
-	// Update GUI if lines were added
-	if linesAdded {
-		fullText := strings.Join(lines, "\n")
-		fyne.Do(func() {
-			if logEntry != nil {
-				logEntry.SetText(fullText)
-			}
-			if logContainer != nil {
-				logContainer.Refresh()
-				logContainer.ScrollToBottom()
-			}
-		})
+	file, err := os.Open(lw.Path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
 	}
-
-	return originalLen, nil
+	defer file.Close()
+
+	// Keep the last n lines in a ring buffer while scanning
+	ring := make([]string, n)
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Compiler output can have very long lines
+	for scanner.Scan() {
+		ring[count%n] = scanner.Text()
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log file: %w", err)
+	}
+	if count <= n {
+		return ring[:count], nil
+	}
+	start := count % n
+	return append(ring[start:], ring[:start]...), nil
 }
 
-// Close closes the log file
+// Close closes the log file(s)
 func (lw *LogWriter) Close() error {
 	lw.mu.Lock()
 	defer lw.mu.Unlock()
 
+	if lw.jsonFile != nil {
+		lw.jsonFile.Close()
+		lw.jsonFile, lw.json = nil, nil
+	}
 	if lw.file != nil {
-		return lw.file.Close()
+		err := lw.file.Close()
+		lw.file = nil
+		return err
 	}
 	return nil
 }
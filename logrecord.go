@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log streams
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+	streamSystem = "system" // Messages from rn-builder itself
+)
+
+// Log levels
+const (
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+// LogRecord is a single structured log line
+type LogRecord struct {
+	Time     time.Time `json:"ts"`
+	RunID    string    `json:"run_id,omitempty"`
+	Step     string    `json:"step,omitempty"`
+	Platform string    `json:"platform,omitempty"` // Set while platforms build in parallel
+	Stream   string    `json:"stream"`
+	Level    string    `json:"level"`
+	Message  string    `json:"msg"`
+}
+
+// LogSink receives structured log records
+type LogSink interface {
+	WriteRecord(rec LogRecord)
+}
+
+// StepEvent reports a step starting or ending, for progress displays. A running step
+// that can tell how far along it is (an upload) sends further running events with
+// Done and Total set.
+type StepEvent struct {
+	Time     time.Time
+	RunID    string
+	Platform string
+	Step     string
+	Status   string // runStatusRunning, then succeeded, failed or cancelled
+	Done     int64  // Units done so far, e.g. bytes uploaded; 0 if the step reports no progress
+	Total    int64
+}
+
+// StepSink is implemented by log sinks that also follow step events
+type StepSink interface {
+	WriteStep(e StepEvent)
+}
+
+// LogSinkFunc adapts a function to the LogSink interface
+type LogSinkFunc func(rec LogRecord)
+
+func (f LogSinkFunc) WriteRecord(rec LogRecord) {
+	f(rec)
+}
+
+// formatLogRecord renders a record as a human-readable log line
+func formatLogRecord(rec LogRecord) string {
+	msg := rec.Message
+	if rec.Stream == streamStderr {
+		msg = "ERR: " + msg
+	}
+	step := rec.Step
+	switch {
+	case rec.Platform == "" || rec.Platform == step:
+	case step == "":
+		step = rec.Platform
+	default:
+		step = rec.Platform + "/" + step // e.g. android/upload
+	}
+	if step == "" {
+		return fmt.Sprintf("%s %s", rec.Time.Format("15:04:05"), msg)
+	}
+	return fmt.Sprintf("%s [%s] %s", rec.Time.Format("15:04:05"), step, msg)
+}
+
+// inferLevel guesses a level from the message text, since most output is free-form
+func inferLevel(msg string) string {
+	lower := strings.ToLower(strings.TrimSpace(msg))
+	switch {
+	case strings.HasPrefix(lower, "error"), strings.HasPrefix(lower, "fatal"),
+		strings.Contains(lower, "build failed"), strings.HasPrefix(lower, "failure:"):
+		return levelError
+	case strings.HasPrefix(lower, "warning"), strings.HasPrefix(lower, "warn"):
+		return levelWarn
+	}
+	return levelInfo
+}
+
+// newRunID returns a sortable, unique identifier for a build run
+func newRunID() string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// RunLogger turns free-form output into LogRecords tagged with the run ID and current step.
+// Writing to it directly logs on the system stream; use Stream for command output.
+type RunLogger struct {
+	mu       sync.Mutex
+	runID    string
+	step     string
+	platform string // Tags records from a platform pipeline running in parallel
+	sinks    []LogSink
+	ctx      context.Context // Cancelled when the run is cancelled; commands started through runCmd stop with it
+
+	system *lineWriter
+}
+
+// NewRunLogger creates a logger for one build run that fans out to the given sinks
+func NewRunLogger(runID string, sinks ...LogSink) *RunLogger {
+	l := &RunLogger{runID: runID, sinks: sinks, ctx: context.Background()}
+	l.system = l.Stream(streamSystem).(*lineWriter)
+	return l
+}
+
+// Fork returns a logger for one platform pipeline: same run, sinks and context, but its
+// own step, and records tagged with the platform so parallel output can be told apart
+func (l *RunLogger) Fork(platform string) *RunLogger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	child := &RunLogger{runID: l.runID, step: platform, platform: platform, sinks: l.sinks, ctx: l.ctx}
+	child.system = child.Stream(streamSystem).(*lineWriter)
+	child.sendStep(child.stepEvent(platform, runStatusRunning))
+	return child
+}
+
+// RunID returns the ID of the run this logger belongs to
+func (l *RunLogger) RunID() string {
+	return l.runID
+}
+
+// SetStep changes the step attached to subsequent records. The previous step counts
+// as succeeded; use EndStep when it failed.
+func (l *RunLogger) SetStep(step string) {
+	l.mu.Lock()
+	if step == l.step {
+		l.mu.Unlock()
+		return
+	}
+	var events []StepEvent
+	if l.step != "" {
+		events = append(events, l.stepEvent(l.step, runStatusSucceeded))
+	}
+	if step != "" {
+		events = append(events, l.stepEvent(step, runStatusRunning))
+	}
+	l.step = step
+	l.mu.Unlock()
+	l.sendStep(events...)
+}
+
+// EndStep ends the current step with the outcome err implies and clears it
+func (l *RunLogger) EndStep(err error) {
+	status := runStatusSucceeded
+	if err != nil {
+		status = runStatusFailed
+		if errors.Is(err, errBuildCancelled) || l.Context().Err() != nil {
+			status = runStatusCancelled
+		}
+	}
+	l.mu.Lock()
+	if l.step == "" {
+		l.mu.Unlock()
+		return
+	}
+	e := l.stepEvent(l.step, status)
+	l.step = ""
+	l.mu.Unlock()
+	l.sendStep(e)
+}
+
+// Progress reports how far along the current step is
+func (l *RunLogger) Progress(done, total int64) {
+	l.mu.Lock()
+	e := l.stepEvent(l.step, runStatusRunning)
+	l.mu.Unlock()
+	if e.Step == "" {
+		return
+	}
+	e.Done, e.Total = done, total
+	l.sendStep(e)
+}
+
+// stepEvent returns an event for step; l.mu must be held (or l not yet shared)
+func (l *RunLogger) stepEvent(step, status string) StepEvent {
+	return StepEvent{Time: time.Now(), RunID: l.runID, Platform: l.platform, Step: step, Status: status}
+}
+
+// sendStep passes events to the sinks that follow steps
+func (l *RunLogger) sendStep(events ...StepEvent) {
+	for _, sink := range l.sinks {
+		if s, ok := sink.(StepSink); ok {
+			for _, e := range events {
+				s.WriteStep(e)
+			}
+		}
+	}
+}
+
+// Step returns the current step name
+func (l *RunLogger) Step() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.step
+}
+
+// Log emits a single record
+func (l *RunLogger) Log(stream, level, msg string) {
+	l.mu.Lock()
+	rec := LogRecord{
+		Time:     time.Now(),
+		RunID:    l.runID,
+		Step:     l.step,
+		Platform: l.platform,
+		Stream:   stream,
+		Level:    level,
+		Message:  msg,
+	}
+	sinks := l.sinks
+	l.mu.Unlock()
+
+	for _, sink := range sinks {
+		sink.WriteRecord(rec)
+	}
+}
+
+// Write logs p on the system stream
+func (l *RunLogger) Write(p []byte) (int, error) {
+	return l.system.Write(p)
+}
+
+// Stream returns a writer whose lines are logged on the given stream
+func (l *RunLogger) Stream(stream string) io.Writer {
+	return &lineWriter{emit: func(line string) {
+		l.Log(stream, inferLevel(line), line)
+	}}
+}
+
+// SetContext sets the context that commands run for this logger are bound to
+func (l *RunLogger) SetContext(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ctx = ctx
+}
+
+// Context returns the run's context
+func (l *RunLogger) Context() context.Context {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ctx
+}
+
+// logContext returns the run context if w is a RunLogger (context.Background otherwise)
+func logContext(w io.Writer) context.Context {
+	if l, ok := w.(*RunLogger); ok {
+		return l.Context()
+	}
+	return context.Background()
+}
+
+// setLogStep sets the current step if w is a RunLogger (no-op for plain writers)
+func setLogStep(w io.Writer, step string) {
+	if l, ok := w.(*RunLogger); ok {
+		l.SetStep(step)
+	}
+}
+
+// endLogStep ends the current step if w is a RunLogger: failed (or cancelled) when err
+// is set, succeeded otherwise
+func endLogStep(w io.Writer, err error) {
+	if l, ok := w.(*RunLogger); ok {
+		l.EndStep(err)
+	}
+}
+
+// logProgress reports the current step's progress if w is a RunLogger
+func logProgress(w io.Writer, done, total int64) {
+	if l, ok := w.(*RunLogger); ok {
+		l.Progress(done, total)
+	}
+}
+
+// commandStreams returns the writers runCmd should use for a command's stdout and stderr
+func commandStreams(w io.Writer) (stdout io.Writer, stderr io.Writer) {
+	if l, ok := w.(*RunLogger); ok {
+		return l.Stream(streamStdout), l.Stream(streamStderr)
+	}
+	return w, &lineWriter{emit: func(line string) {
+		fmt.Fprintln(w, "ERR: "+line)
+	}}
+}
+
+// lineWriter splits written bytes into lines and emits each complete one
+type lineWriter struct {
+	mu      sync.Mutex
+	pending bytes.Buffer
+	emit    func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending.Write(p)
+	for {
+		line, err := w.pending.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			w.pending.Reset()
+			w.pending.WriteString(line)
+			break
+		}
+		w.emit(strings.TrimRight(line, "\r\n"))
+	}
+	return len(p), nil
+}
+
+// textSink writes human-readable records to a plain writer (used by the CLI)
+type textSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *textSink) WriteRecord(rec LogRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.w, formatLogRecord(rec))
+}
+
+// jsonLinesSink writes one JSON object per record, for other tools to parse
+type jsonLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *jsonLinesSink) WriteRecord(rec LogRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(append(data, '\n'))
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	maxLogLines        = 50000                  // Lines kept in memory for the GUI log view
+	logRefreshInterval = 150 * time.Millisecond // How often pending lines are pushed to the list
+	allStepsOption     = "All steps"
+	allPlatformsOption = "All platforms"
+)
+
+var logView *LogView // The GUI log viewer
+
+// logRing is a fixed-size ring buffer of log records (not safe for concurrent use)
+type logRing struct {
+	buf   []LogRecord
+	start int
+	count int
+	added uint64 // Records ever added; the newest has sequence number added-1
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{buf: make([]LogRecord, size)}
+}
+
+// Add stores rec, overwriting the oldest record when full, and returns its sequence number
+func (r *logRing) Add(rec LogRecord) uint64 {
+	idx := (r.start + r.count) % len(r.buf)
+	r.buf[idx] = rec
+	if r.count < len(r.buf) {
+		r.count++
+	} else {
+		r.start = (r.start + 1) % len(r.buf) // Overwrite the oldest line
+	}
+	r.added++
+	return r.added - 1
+}
+
+func (r *logRing) Get(i int) LogRecord {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+func (r *logRing) Len() int {
+	return r.count
+}
+
+// Oldest returns the sequence number of the oldest record still in the buffer
+func (r *logRing) Oldest() uint64 {
+	return r.added - uint64(r.count)
+}
+
+func (r *logRing) Reset() {
+	r.start, r.count = 0, 0
+}
+
+// LogView is a virtualized, filterable log display backed by a ring buffer
+type LogView struct {
+	mu       sync.Mutex
+	ring     *logRing
+	dirty    bool
+	query    string
+	errOnly  bool
+	step     string          // Empty means all steps
+	runID    string          // Empty means all runs
+	platform string          // Empty means all platforms; shared steps are always shown
+	steps    []string        // Steps seen so far, in order
+	stepSet  map[string]bool // Lookup for steps
+
+	// Records matching the filters, oldest first, with their ring sequence numbers. New
+	// records are appended as they arrive; the ring is only re-filtered when a filter
+	// changes. Elements are never modified in place, so a prefix can be handed to the
+	// fyne thread without copying.
+	filtered    []LogRecord
+	filteredSeq []uint64
+	refilter    bool
+
+	logPath string // Log file of the current run, for "Open Full Log"
+
+	visible []LogRecord // Records currently shown; only touched on the fyne thread
+
+	list       *widget.List
+	search     *widget.Entry
+	errCheck   *widget.Check
+	stepSelect *widget.Select
+	platSelect *widget.Select
+	autoScroll *widget.Check
+	openButton *widget.Button
+}
+
+// NewLogView creates the log view and starts its refresh loop
+func NewLogView(window fyne.Window) *LogView {
+	lv := &LogView{ring: newLogRing(maxLogLines), stepSet: make(map[string]bool)}
+
+	lv.list = widget.NewList(
+		func() int { return len(lv.visible) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.TextStyle = fyne.TextStyle{Monospace: true}
+			return label
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			label := obj.(*widget.Label)
+			if id >= len(lv.visible) {
+				label.SetText("")
+				return
+			}
+			rec := lv.visible[id]
+			switch {
+			case rec.Level == levelError:
+				label.Importance = widget.DangerImportance
+			case rec.Level == levelWarn:
+				label.Importance = widget.WarningImportance
+			case rec.Stream == streamSystem:
+				label.Importance = widget.HighImportance
+			default:
+				label.Importance = widget.MediumImportance
+			}
+			label.SetText(formatLogRecord(rec))
+		},
+	)
+
+	lv.search = widget.NewEntry()
+	lv.search.PlaceHolder = "Search log..."
+	lv.search.OnChanged = func(s string) {
+		lv.mu.Lock()
+		lv.query = strings.ToLower(s)
+		lv.refilter = true
+		lv.mu.Unlock()
+	}
+
+	lv.errCheck = widget.NewCheck("Errors only", func(checked bool) {
+		lv.mu.Lock()
+		lv.errOnly = checked
+		lv.refilter = true
+		lv.mu.Unlock()
+	})
+
+	lv.stepSelect = widget.NewSelect([]string{allStepsOption}, func(selected string) {
+		lv.mu.Lock()
+		lv.step = selected
+		if selected == allStepsOption {
+			lv.step = ""
+		}
+		lv.refilter = true
+		lv.mu.Unlock()
+	})
+	lv.stepSelect.SetSelected(allStepsOption)
+
+	// Android and iOS build in parallel; this picks one platform's output like a tab
+	lv.platSelect = widget.NewSelect([]string{allPlatformsOption, "android", "ios"}, func(selected string) {
+		lv.mu.Lock()
+		lv.platform = selected
+		if selected == allPlatformsOption {
+			lv.platform = ""
+		}
+		lv.refilter = true
+		lv.mu.Unlock()
+	})
+	lv.platSelect.SetSelected(allPlatformsOption)
+
+	lv.autoScroll = widget.NewCheck("Auto-scroll", func(checked bool) {
+		if checked {
+			lv.list.ScrollToBottom()
+		}
+	})
+	lv.autoScroll.SetChecked(true)
+
+	lv.openButton = widget.NewButton("Open Full Log", func() {
+		lv.mu.Lock()
+		logPath := lv.logPath
+		lv.mu.Unlock()
+		if logPath == "" {
+			dialog.ShowInformation("No Log", "No build has been run yet.", window)
+			return
+		}
+		path, err := filepath.Abs(logPath)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if err := guiApp.OpenURL(&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}); err != nil {
+			dialog.ShowError(err, window)
+		}
+	})
+
+	go lv.refreshLoop()
+	return lv
+}
+
+// isErrRecord reports whether a record came from a command's stderr or reports a failure
+func isErrRecord(rec LogRecord) bool {
+	return rec.Stream == streamStderr || rec.Level == levelError
+}
+
+// Append adds a record to the buffer; the list is refreshed on the next tick
+func (lv *LogView) Append(rec LogRecord) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	seq := lv.ring.Add(rec)
+	// Drop the record the ring just overwrote, if it was shown
+	oldest := lv.ring.Oldest()
+	for len(lv.filteredSeq) > 0 && lv.filteredSeq[0] < oldest {
+		lv.filtered, lv.filteredSeq = lv.filtered[1:], lv.filteredSeq[1:]
+	}
+	if !lv.refilter && lv.matchesLocked(rec) {
+		lv.filtered = append(lv.filtered, rec)
+		lv.filteredSeq = append(lv.filteredSeq, seq)
+	}
+	if rec.Step != "" && !lv.stepSet[rec.Step] {
+		lv.stepSet[rec.Step] = true
+		lv.steps = append(lv.steps, rec.Step)
+	}
+	lv.dirty = true
+}
+
+// SetLogPath sets the file opened by "Open Full Log"
+func (lv *LogView) SetLogPath(path string) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	lv.logPath = path
+}
+
+// SetRun shows only the records of one run (empty shows all runs)
+func (lv *LogView) SetRun(runID string) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	lv.runID = runID
+	lv.refilter = true
+}
+
+// Clear removes all lines from the view
+func (lv *LogView) Clear() {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	lv.ring.Reset()
+	lv.steps = nil
+	lv.stepSet = make(map[string]bool)
+	lv.filtered, lv.filteredSeq = nil, nil
+	lv.dirty = true
+}
+
+// refreshLoop batches updates so Gradle's output rate doesn't flood the UI thread
+func (lv *LogView) refreshLoop() {
+	ticker := time.NewTicker(logRefreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		lv.mu.Lock()
+		if !lv.dirty && !lv.refilter {
+			lv.mu.Unlock()
+			continue
+		}
+		lv.dirty = false
+		snapshot := lv.snapshotLocked()
+		stepOptions := append([]string{allStepsOption}, lv.steps...)
+		lv.mu.Unlock()
+
+		fyne.Do(func() {
+			if !slices.Equal(stepOptions, lv.stepSelect.Options) {
+				lv.stepSelect.SetOptions(stepOptions)
+			}
+			lv.visible = snapshot
+			lv.list.Refresh()
+			if lv.autoScroll.Checked {
+				lv.list.ScrollToBottom()
+			}
+		})
+	}
+}
+
+// snapshotLocked returns the records matching the current filters, re-filtering the
+// whole ring only after a filter changed; lv.mu must be held
+func (lv *LogView) snapshotLocked() []LogRecord {
+	if lv.refilter {
+		lv.refilter = false
+		lv.filtered, lv.filteredSeq = nil, nil
+		oldest := lv.ring.Oldest()
+		for i := 0; i < lv.ring.Len(); i++ {
+			if rec := lv.ring.Get(i); lv.matchesLocked(rec) {
+				lv.filtered = append(lv.filtered, rec)
+				lv.filteredSeq = append(lv.filteredSeq, oldest+uint64(i))
+			}
+		}
+	}
+	return lv.filtered[:len(lv.filtered):len(lv.filtered)]
+}
+
+// matchesLocked reports whether rec passes the current filters; lv.mu must be held
+func (lv *LogView) matchesLocked(rec LogRecord) bool {
+	switch {
+	case lv.runID != "" && rec.RunID != lv.runID:
+		return false
+	case lv.platform != "" && rec.Platform != "" && rec.Platform != lv.platform:
+		return false
+	case lv.errOnly && !isErrRecord(rec):
+		return false
+	case lv.step != "" && rec.Step != lv.step:
+		return false
+	case lv.query != "" && !strings.Contains(strings.ToLower(rec.Message), lv.query):
+		return false
+	}
+	return true
+}
+
+// Container returns the toolbar and list laid out for the main window
+func (lv *LogView) Container() fyne.CanvasObject {
+	toolbar := container.NewBorder(nil, nil, nil,
+		container.NewHBox(lv.platSelect, lv.stepSelect, lv.errCheck, lv.autoScroll, lv.openButton),
+		lv.search,
+	)
+	return container.NewBorder(toolbar, nil, nil, nil, lv.list)
+}
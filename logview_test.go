@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func visibleMessages(lv *LogView) []string {
+	var out []string
+	for _, rec := range lv.snapshotLocked() {
+		out = append(out, rec.Message)
+	}
+	return out
+}
+
+func TestLogViewFilteredRecords(t *testing.T) {
+	lv := &LogView{ring: newLogRing(4), stepSet: make(map[string]bool)}
+	lv.Append(LogRecord{Message: "one", Step: "deps"})
+	lv.Append(LogRecord{Message: "Two", Step: "build"})
+	if got := visibleMessages(lv); !slices.Equal(got, []string{"one", "Two"}) {
+		t.Fatalf("visible = %v", got)
+	}
+
+	// Records that arrive while a filter is set are matched as they come in
+	lv.query = "t"
+	lv.refilter = true
+	if got := visibleMessages(lv); !slices.Equal(got, []string{"Two"}) {
+		t.Fatalf("visible after search = %v", got)
+	}
+	lv.Append(LogRecord{Message: "three", Step: "build"})
+	lv.Append(LogRecord{Message: "four", Step: "build"})
+	if got := visibleMessages(lv); !slices.Equal(got, []string{"Two", "three"}) {
+		t.Fatalf("visible after appends = %v", got)
+	}
+
+	// Records the ring overwrites disappear from the view
+	lv.Append(LogRecord{Message: "five", Step: "upload"})
+	lv.Append(LogRecord{Message: "six", Step: "upload"})
+	if got := visibleMessages(lv); !slices.Equal(got, []string{"three"}) {
+		t.Fatalf("visible after wrap = %v", got)
+	}
+
+	lv.query, lv.step = "", "upload"
+	lv.refilter = true
+	if got := visibleMessages(lv); !slices.Equal(got, []string{"five", "six"}) {
+		t.Fatalf("visible for step = %v", got)
+	}
+
+	lv.Clear()
+	lv.Append(LogRecord{Message: "seven", Step: "upload"})
+	if got := visibleMessages(lv); !slices.Equal(got, []string{"seven"}) {
+		t.Fatalf("visible after clear = %v", got)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -24,15 +27,33 @@ func updateUIFromConfig(config *Config, entries map[string]interface{}) {
 	if e, ok := entries["version"].(*widget.Entry); ok {
 		e.SetText(config.BuildVersion)
 	}
+	if s, ok := entries["versionSource"].(*widget.Select); ok {
+		s.SetSelected(config.VersionSource)
+	}
+	if c, ok := entries["writeVersion"].(*widget.Check); ok {
+		c.SetChecked(config.WriteVersion)
+	}
 	if r, ok := entries["platform"].(*widget.RadioGroup); ok {
 		r.SetSelected(config.Platform)
 	}
+	if e, ok := entries["ref"].(*widget.Entry); ok {
+		e.SetText(config.Ref)
+	}
+	if e, ok := entries["branch"].(*widget.Entry); ok {
+		e.SetText(config.Branch)
+	}
 	if c, ok := entries["skipUpload"].(*widget.Check); ok {
 		c.SetChecked(config.SkipUpload)
 	}
 	if c, ok := entries["skipDeps"].(*widget.Check); ok {
 		c.SetChecked(config.SkipDeps)
 	}
+	if c, ok := entries["forceReinstall"].(*widget.Check); ok {
+		c.SetChecked(config.ForceReinstall)
+	}
+	if c, ok := entries["cleanPrebuild"].(*widget.Check); ok {
+		c.SetChecked(config.CleanPrebuild)
+	}
 	if e, ok := entries["androidBuildType"].(*widget.Entry); ok {
 		e.SetText(config.Android.BuildType)
 	}
@@ -59,9 +80,10 @@ func updateUIFromConfig(config *Config, entries map[string]interface{}) {
 	}
 }
 
-// getConfigFromUI creates a Config struct from the current UI state
-func getConfigFromUI(entries map[string]interface{}) Config {
-	config := Config{}
+// getConfigFromUI overlays the current UI state on base, so settings without
+// a UI control (log_dir, json_logs, ...) survive a save or build
+func getConfigFromUI(base Config, entries map[string]interface{}) Config {
+	config := base
 
 	if e, ok := entries["rootPath"].(*widget.Entry); ok {
 		config.RootPath = e.Text
@@ -69,15 +91,33 @@ func getConfigFromUI(entries map[string]interface{}) Config {
 	if e, ok := entries["version"].(*widget.Entry); ok {
 		config.BuildVersion = e.Text
 	}
+	if s, ok := entries["versionSource"].(*widget.Select); ok {
+		config.VersionSource = s.Selected
+	}
+	if c, ok := entries["writeVersion"].(*widget.Check); ok {
+		config.WriteVersion = c.Checked
+	}
 	if r, ok := entries["platform"].(*widget.RadioGroup); ok {
 		config.Platform = r.Selected
 	}
+	if e, ok := entries["ref"].(*widget.Entry); ok {
+		config.Ref = e.Text
+	}
+	if e, ok := entries["branch"].(*widget.Entry); ok {
+		config.Branch = e.Text
+	}
 	if c, ok := entries["skipUpload"].(*widget.Check); ok {
 		config.SkipUpload = c.Checked
 	}
 	if c, ok := entries["skipDeps"].(*widget.Check); ok {
 		config.SkipDeps = c.Checked
 	}
+	if c, ok := entries["forceReinstall"].(*widget.Check); ok {
+		config.ForceReinstall = c.Checked
+	}
+	if c, ok := entries["cleanPrebuild"].(*widget.Check); ok {
+		config.CleanPrebuild = c.Checked
+	}
 	if e, ok := entries["androidBuildType"].(*widget.Entry); ok {
 		config.Android.BuildType = e.Text
 	}
@@ -106,13 +146,26 @@ func getConfigFromUI(entries map[string]interface{}) Config {
 	return config
 }
 
+// cliArgs drops the -psn_ process serial number older macOS versions pass when the app
+// is opened from Finder, which must not switch to CLI mode
+func cliArgs(args []string) []string {
+	return slices.DeleteFunc(slices.Clone(args), func(arg string) bool { return strings.HasPrefix(arg, "-psn_") })
+}
+
 func main() {
+	// Any arguments switch to headless CLI mode
+	if args := cliArgs(os.Args[1:]); len(args) > 0 {
+		os.Exit(runCLI(args))
+	}
+
 	guiApp = app.NewWithID("com.mps.rn_builder")
 	window := guiApp.NewWindow("React Native Builder")
 	window.Resize(fyne.NewSize(800, 800)) // Set a reasonable initial size
 
 	// Create a map to store UI elements for easy access
 	uiEntries := make(map[string]interface{})
+	// Last loaded config; keeps settings that have no UI control
+	var baseConfig Config
 
 	// --- Create UI Widgets ---
 	// Root Path
@@ -135,17 +188,84 @@ func main() {
 		}
 		return nil
 	}
+	versionSourceSelect := widget.NewSelect(versionSources, nil)
+	uiEntries["versionSource"] = versionSourceSelect
+	versionSourceSelect.PlaceHolder = versionSourceConfig
+	readVersionButton := widget.NewButton("Read", func() {
+		source := versionSourceSelect.Selected
+		if source == "" || source == versionSourceConfig {
+			source = versionSourceAuto
+		}
+		version, from, err := readVersionFromSource(rootPathEntry.Text, source)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to read version: %w", err), window)
+			return
+		}
+		versionEntry.SetText(version)
+		dialog.ShowInformation("Version", fmt.Sprintf("Read version %s from %s", version, from), window)
+	})
+	writeVersionCheck := widget.NewCheck("Write to app.json/package.json", nil)
+	uiEntries["writeVersion"] = writeVersionCheck
+	bumpButtons := container.NewHBox()
+	for _, part := range []string{"major", "minor", "patch"} {
+		bumpButtons.Add(widget.NewButton("+"+part, func() {
+			config := getConfigFromUI(baseConfig, uiEntries)
+			// Like version bump in the CLI: build_version goes to the config file, and
+			// app.json / package.json when the version comes from or is written to them
+			configFile := filepath.Join(".", defaultConfig)
+			fromConfig := config.VersionSource == "" || config.VersionSource == versionSourceConfig
+			var targets []string
+			if _, err := os.Stat(configFile); fromConfig && err == nil {
+				targets = append(targets, defaultConfig)
+			} else {
+				configFile = ""
+			}
+			if !fromConfig || config.WriteVersion {
+				targets = append(targets, "app.json/package.json")
+			}
+			commit := len(targets) > 0
+			msg := fmt.Sprintf("Bump the %s version, write it to %s and commit the change?", part, strings.Join(targets, " and "))
+			if !commit {
+				msg = fmt.Sprintf("Bump the %s version? There is no config file yet; Save Config writes it.", part)
+			}
+			dialog.ShowConfirm("Bump Version", msg, func(ok bool) {
+				if !ok {
+					return
+				}
+				var out bytes.Buffer
+				version, err := bumpVersion(config, configFile, part, commit, &out)
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("version bump failed: %w", err), window)
+					return
+				}
+				versionEntry.SetText(version)
+				dialog.ShowInformation("Version Bumped", out.String(), window)
+			}, window)
+		}))
+	}
 
 	// Platform
 	platformRadio := widget.NewRadioGroup([]string{"All", "Android", "iOS"}, nil)
 	uiEntries["platform"] = platformRadio
 	platformRadio.SetSelected("All") // Default selection
 
+	// Git Ref
+	refEntry := widget.NewEntry()
+	uiEntries["ref"] = refEntry
+	refEntry.PlaceHolder = "Optional: branch, tag or SHA (built in a temporary worktree)"
+	branchEntry := widget.NewEntry()
+	uiEntries["branch"] = branchEntry
+	branchEntry.PlaceHolder = "Optional: auto-detected from ref, CI or git (main = PROD, staging = STAGING)"
+
 	// Options
 	skipUploadCheck := widget.NewCheck("Skip Uploads", nil)
 	uiEntries["skipUpload"] = skipUploadCheck
 	skipDepsCheck := widget.NewCheck("Skip Dependencies", nil)
 	uiEntries["skipDeps"] = skipDepsCheck
+	forceReinstallCheck := widget.NewCheck("Force Reinstall", nil)
+	uiEntries["forceReinstall"] = forceReinstallCheck
+	cleanPrebuildCheck := widget.NewCheck("Clean Prebuild", nil)
+	uiEntries["cleanPrebuild"] = cleanPrebuildCheck
 
 	// Android Specific
 	androidBuildTypeEntry := widget.NewEntry()
@@ -182,7 +302,7 @@ func main() {
 
 	// Config buttons
 	saveConfigButton := widget.NewButton("Save Config", func() {
-		config := getConfigFromUI(uiEntries)
+		config := getConfigFromUI(baseConfig, uiEntries)
 		configPath := filepath.Join(".", defaultConfig)
 		if err := config.SaveConfig(configPath); err != nil {
 			dialog.ShowError(fmt.Errorf("failed to save config: %w", err), window)
@@ -198,6 +318,7 @@ func main() {
 			dialog.ShowError(fmt.Errorf("failed to load config: %w", err), window)
 			return
 		}
+		baseConfig = *config
 		updateUIFromConfig(config, uiEntries)
 		dialog.ShowInformation("Success", "Configuration loaded successfully", window)
 	})
@@ -235,74 +356,106 @@ func main() {
 	if _, err := os.Stat(configPath); err == nil {
 		config, err := LoadConfig(configPath)
 		if err == nil {
+			baseConfig = *config
 			updateUIFromConfig(config, uiEntries)
 		}
 	}
 
 	// Log Area
-	logEntry = widget.NewMultiLineEntry()
-	logEntry.Wrapping = fyne.TextWrapWord // Prevent wrapping for better log readability
-	logEntry.SetMinRowsVisible(15)        // Show a good amount of log lines
-
-	// Build Button
-	buildButton := widget.NewButton("Run Build", nil) // OnTapped set later
+	logView = NewLogView(window)
+	stepView := NewStepView()
+
+	// Likely cause panel, shown when a failed build matches a known problem
+	likelyCauseLabel := widget.NewLabel("")
+	likelyCauseLabel.Wrapping = fyne.TextWrapWord
+	likelyCauseCard := widget.NewCard("Likely cause", "", likelyCauseLabel)
+	likelyCauseCard.Hide()
+
+	// Build queue: builds run in the background, several at once within the per-platform
+	// limits, and queued ones survive a restart. Profiles next to the config can be
+	// queued from the tray.
+	queuePath, err := queueStatePath("gui")
+	if err != nil {
+		log.Fatalf("Failed to locate the queue file: %v", err)
+	}
+	logDir, err := resolveLogDir(baseConfig)
+	if err != nil {
+		log.Fatalf("Failed to locate the log directory: %v", err)
+	}
+	profiles := newProfileLoader(configPath, "", logDir)
+	queue, err := NewBuildQueue(queuePath, baseConfig.Queue, profiles.load, LogSinkFunc(logView.Append), stepView)
+	if err != nil {
+		// Keep the unreadable file for inspection and start with an empty queue
+		log.Printf("Warning: %v", err)
+		os.Rename(queuePath, queuePath+".bad")
+		if queue, err = NewBuildQueue(queuePath, baseConfig.Queue, profiles.load, LogSinkFunc(logView.Append), stepView); err != nil {
+			log.Fatalf("Failed to create the build queue: %v", err)
+		}
+	}
+	queuePanel := NewQueuePanel(queue, window, func(job Job) {
+		// Show the selected job's run in the log view
+		logView.SetRun(job.RunID)
+		logView.SetLogPath(job.LogPath())
+		stepView.SetRun(job.RunID)
+	})
+	tray := NewTrayIcon(guiApp, window, queue, profiles)
+	queue.OnChange = func() {
+		queuePanel.Refresh()
+		tray.Refresh()
+	}
+	queue.OnFinish = func(job Job, err error) {
+		sendBuildNotification(guiApp, job, err)
+		if err == nil {
+			return
+		}
+		log.Printf("Build Error: %v", err) // Log error to console as well
+		if diagnoses := diagnosesFromError(err); len(diagnoses) > 0 {
+			summary := fmt.Sprintf("%s %s:\n%s", strings.Join(job.Platforms, "+"), job.Version, formatDiagnoses(diagnoses))
+			fyne.Do(func() {
+				likelyCauseLabel.SetText(summary)
+				likelyCauseCard.Show()
+			})
+		}
+	}
+	queue.Start()
 
-	// --- Build Button Action ---
-	buildButton.OnTapped = func() {
-		logBuffer.Reset()    // Clear previous logs
-		logEntry.SetText("") // Update UI
-		buildButton.Disable()
+	// Build Button: adds the current settings to the queue
+	buildButton := widget.NewButton("Run Build", func() {
+		likelyCauseCard.Hide()
 
 		// --- Gather Config from UI ---
-		config := getConfigFromUI(uiEntries)
+		config := getConfigFromUI(baseConfig, uiEntries)
 
-		// Basic Validation
-		if err := versionEntry.Validate(); err != nil {
+		// Basic Validation (a version read from the project is checked during the build)
+		readsVersion := config.VersionSource != "" && config.VersionSource != versionSourceConfig
+		if err := versionEntry.Validate(); err != nil && !readsVersion {
 			dialog.ShowError(fmt.Errorf("invalid build version: %w", err), window)
-			buildButton.Enable()
 			return
 		}
 		if config.Platform == "" {
 			dialog.ShowError(fmt.Errorf("please select a platform"), window)
-			buildButton.Enable()
 			return
 		}
 		// Add more validation as needed (e.g., required fields for uploads)
 
-		// --- Run Build in Goroutine ---
-		go func() {
-			// Ensure button is re-enabled when done
-			defer buildButton.Enable()
-			// Update log entry periodically or at the end
-			// A simple way is to just update at the end, but better is periodic
-			// For simplicity here, we update periodically via the LogWriter hook indirectly
-			// by writing to the buffer which the main loop can check.
-			// A more robust way involves channels or fyne.CurrentApp().QueueEvent.
-
-			err := runBuildProcess(config, logWriter) // Pass the config and log writer
-
-			if err != nil {
-				// Show error dialog (must be called from main thread or via QueueEvent)
-				// dialog.ShowError(err, window) // This might panic if called from goroutine
-				log.Printf("Build Error: %v", err) // Log error to console as well
-				// Append error to GUI log area safely
-				fmt.Fprintf(logWriter, "\n\nBUILD FAILED: %v\n", err)
-				logEntry.SetText(logBuffer.String()) // Refresh log view
-			} else {
-				fmt.Fprintf(logWriter, "\n\nBUILD SUCCEEDED!\n")
-				logEntry.SetText(logBuffer.String()) // Refresh log view
-				// dialog.ShowInformation("Success", "Build process completed successfully!", window) // Also needs main thread
-			}
-		}() // End of goroutine
-	} // End of OnTapped
+		job, err := queue.Enqueue(config, BuildRequest{Trigger: triggerManual})
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to queue build: %w", err), window)
+			return
+		}
+		queuePanel.Select(job.ID) // Follow the new build in the log view
+	})
 
 	// --- Layout ---
 	// Use a Form for better label alignment
 	form := widget.NewForm(
 		widget.NewFormItem("Root Path", container.NewBorder(nil, nil, nil, rootPathButton, rootPathEntry)),
-		widget.NewFormItem("Build Version*", versionEntry),
+		widget.NewFormItem("Build Version*", container.NewBorder(nil, nil, nil,
+			container.NewHBox(versionSourceSelect, readVersionButton, bumpButtons, writeVersionCheck), versionEntry)),
 		widget.NewFormItem("Platform*", platformRadio),
-		widget.NewFormItem("Options", container.NewHBox(skipUploadCheck, skipDepsCheck)),
+		widget.NewFormItem("Git Ref", refEntry),
+		widget.NewFormItem("Branch Override", branchEntry),
+		widget.NewFormItem("Options", container.NewHBox(skipUploadCheck, skipDepsCheck, forceReinstallCheck, cleanPrebuildCheck)),
 	)
 
 	androidSection := container.NewVBox(
@@ -343,26 +496,22 @@ func main() {
 		iosSection,
 	)
 
-	logContainer = container.NewScroll(logEntry) // Make log area scrollable
-
-	// Initialize the log writer with file output
-	var err error
-	logWriter, err = NewLogWriter()
-	if err != nil {
-		dialog.ShowError(fmt.Errorf("failed to initialize logging: %w", err), window)
-		return
-	}
-	defer logWriter.Close() // Ensure log file is closed when application exits
-
-	// Main layout: Settings | Build Button | Logs
+	// Main layout: Settings | Build Button | Queue + Steps | Likely cause + Logs
+	runPanel := container.NewVSplit(queuePanel.Container(), stepView.Container())
+	logs := container.NewHSplit(runPanel,
+		container.NewBorder(likelyCauseCard, nil, nil, nil, logView.Container()))
+	logs.Offset = 0.3
 	content := container.NewBorder(
-		settings,     // Top
-		buildButton,  // Bottom
-		nil,          // Left
-		nil,          // Right
-		logContainer, // Center
+		settings,    // Top
+		buildButton, // Bottom
+		nil,         // Left
+		nil,         // Right
+		logs,        // Center
 	)
 
 	window.SetContent(content)
 	window.ShowAndRun() // Blocks until window is closed
+
+	// Running builds are cancelled (restoring the files they edited); queued ones are kept
+	queue.Shutdown()
 }
@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestCLIArgs(t *testing.T) {
+	if args := cliArgs([]string{"-psn_0_123456"}); len(args) != 0 {
+		t.Errorf("Finder launch args = %q, want none (GUI mode)", args)
+	}
+	if args := cliArgs([]string{"build", "-psn_0_1", "-platform", "ios"}); len(args) != 3 || args[0] != "build" || args[2] != "ios" {
+		t.Errorf("cliArgs = %q", args)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Matches both Groovy (versionCode 12) and Kotlin DSL (versionCode = 12) declarations
+var (
+	gradleVersionCodeRe = regexp.MustCompile(`(\bversionCode\s*=?\s*)\d+`)
+	gradleVersionNameRe = regexp.MustCompile(`(\bversionName\s*=?\s*)"[^"]*"`)
+)
+
+// findAppBuildGradle returns android/app/build.gradle, or build.gradle.kts if that is what the project uses
+func findAppBuildGradle(rootPath string) (string, error) {
+	appDir := filepath.Join(rootPath, "android", "app")
+	for _, name := range []string{"build.gradle", "build.gradle.kts"} {
+		path := filepath.Join(appDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no build.gradle or build.gradle.kts found in %s", appDir)
+}
+
+// injectAndroidVersion sets versionCode and versionName in the app's Gradle file, whatever
+// values they currently hold (prebuild writes 1/"1.0", bare projects keep their own)
+func injectAndroidVersion(rootPath, versionName string, versionCode int, touched *fileSnapshot) error {
+	gradlePath, err := findAppBuildGradle(rootPath)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(gradlePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(gradlePath), err)
+	}
+	if !gradleVersionCodeRe.Match(content) || !gradleVersionNameRe.Match(content) {
+		return fmt.Errorf("versionCode/versionName not found in %s", gradlePath)
+	}
+
+	updated := gradleVersionCodeRe.ReplaceAll(content, []byte(fmt.Sprintf("${1}%d", versionCode)))
+	updated = gradleVersionNameRe.ReplaceAll(updated, []byte(fmt.Sprintf(`${1}"%s"`, versionName)))
+	if err := touched.Track(gradlePath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(gradlePath, updated, 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %w", filepath.Base(gradlePath), err)
+	}
+	return nil
+}
+
+// xcodeVersionSettings are build setting overrides for xcodebuild. Bare projects usually
+// reference $(MARKETING_VERSION) and $(CURRENT_PROJECT_VERSION) from Info.plist, and
+// overriding them also versions app extensions consistently.
+func xcodeVersionSettings(versionName string, buildNumber int) []string {
+	return []string{
+		fmt.Sprintf("MARKETING_VERSION=%s", versionName),
+		fmt.Sprintf("CURRENT_PROJECT_VERSION=%d", buildNumber),
+	}
+}
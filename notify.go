@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Build events notifiers can subscribe to
+const (
+	eventStart   = "start"
+	eventSuccess = "success"
+	eventFailure = "failure" // Includes cancelled runs
+)
+
+// Notifier types (notifications[].type)
+const (
+	notifierWebhook = "webhook" // Generic JSON: the event name plus the run manifest
+	notifierSlack   = "slack"   // Slack incoming webhook (Block Kit)
+	notifierTeams   = "teams"   // Microsoft Teams workflow webhook (Adaptive Card)
+	notifierEmail   = "email"   // SMTP: HTML+text summary, log tail attached on failure
+)
+
+const (
+	notifyTimeout       = 15 * time.Second
+	notifyMaxNotesChars = 2500 // Release notes beyond this are cut from chat messages
+	notifyLogTailLines  = 200  // Log lines attached to failure emails
+)
+
+var notifyHTTPClient = &http.Client{Timeout: notifyTimeout}
+
+// NotifierConfig configures one notification target. Several targets of the same type
+// can be listed, e.g. one email profile per audience restricted with environments.
+type NotifierConfig struct {
+	Type         string   `yaml:"type"`         // webhook, slack, teams or email
+	URL          string   `yaml:"url"`          // Webhook URL; ${VAR} is expanded from the environment when sending
+	Events       []string `yaml:"events"`       // start, success and/or failure (default: all)
+	Environments []string `yaml:"environments"` // Only notify for these environments (PROD, STAGING, DEV; default: all)
+
+	// SMTP settings (type email); ${VAR} in username and password is expanded when sending
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"` // Default 587 (STARTTLS); 465 uses implicit TLS
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// BuildEvent is what notifiers are told about a run
+type BuildEvent struct {
+	Event    string
+	Manifest RunManifest // Copy taken when the event fired
+	LogPath  string
+	LogTail  []string // Last lines of the log, only set for failures
+}
+
+// Notifier delivers build events to one target
+type Notifier interface {
+	Name() string
+	Wants(e BuildEvent) bool
+	Notify(ctx context.Context, e BuildEvent) error
+}
+
+// notifierFilter is the event and environment selection shared by all notifiers
+type notifierFilter struct {
+	events       []string
+	environments []string
+}
+
+// Wants reports whether e passes the filter. The start event fires before the branch is
+// resolved, so environment-restricted targets only hear about success and failure.
+func (f notifierFilter) Wants(e BuildEvent) bool {
+	if len(f.events) > 0 && !slices.Contains(f.events, e.Event) {
+		return false
+	}
+	if len(f.environments) > 0 && !slices.ContainsFunc(f.environments, func(env string) bool {
+		return strings.EqualFold(env, e.Manifest.Environment)
+	}) {
+		return false
+	}
+	return true
+}
+
+// newNotifiers validates the notification settings and creates the notifiers
+func newNotifiers(configs []NotifierConfig) ([]Notifier, error) {
+	var notifiers []Notifier
+	for i, c := range configs {
+		for _, event := range c.Events {
+			if event != eventStart && event != eventSuccess && event != eventFailure {
+				return nil, fmt.Errorf("notifications[%d]: unknown event '%s' (expected start, success or failure)", i, event)
+			}
+		}
+		filter := notifierFilter{events: c.Events, environments: c.Environments}
+		switch c.Type {
+		case notifierWebhook, notifierSlack, notifierTeams:
+			if c.URL == "" {
+				return nil, fmt.Errorf("notifications[%d]: url is required for %s", i, c.Type)
+			}
+			notifiers = append(notifiers, &webhookNotifier{notifierFilter: filter, format: c.Type, url: c.URL})
+		case notifierEmail:
+			n, err := newEmailNotifier(c, filter)
+			if err != nil {
+				return nil, fmt.Errorf("notifications[%d]: %w", i, err)
+			}
+			notifiers = append(notifiers, n)
+		default:
+			return nil, fmt.Errorf("notifications[%d]: unknown type '%s' (expected webhook, slack, teams or email)", i, c.Type)
+		}
+	}
+	return notifiers, nil
+}
+
+// notifyAll sends e to every notifier subscribed to it. Failures are logged, never fatal.
+func notifyAll(notifiers []Notifier, e BuildEvent, logOutput io.Writer) {
+	for _, n := range notifiers {
+		if !n.Wants(e) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		err := n.Notify(ctx, e)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(logOutput, "Warning: %s notification failed: %v\n", n.Name(), err)
+		} else {
+			fmt.Fprintf(logOutput, "Sent %s notification (%s)\n", n.Name(), e.Event)
+		}
+	}
+}
+
+// webhookNotifier POSTs a JSON payload in one of the supported formats
+type webhookNotifier struct {
+	notifierFilter
+	format string
+	url    string
+}
+
+func (n *webhookNotifier) Name() string { return n.format }
+
+func (n *webhookNotifier) Notify(ctx context.Context, e BuildEvent) error {
+	var payload any
+	switch n.format {
+	case notifierSlack:
+		payload = slackPayload(e)
+	case notifierTeams:
+		payload = teamsPayload(e)
+	default:
+		payload = webhookPayload(e)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	return postJSON(ctx, os.ExpandEnv(n.url), body)
+}
+
+// postJSON posts body, retrying once on network errors and 5xx responses
+func postJSON(ctx context.Context, url string, body []byte) error {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("invalid webhook URL: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := notifyHTTPClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		if resp.StatusCode < 500 {
+			break // Client errors will not go away on retry
+		}
+	}
+	return lastErr
+}
+
+// eventTitle is the one-line summary of an event
+func eventTitle(e BuildEvent) string {
+	m := e.Manifest
+	what := fmt.Sprintf("%s %s", m.Platform, m.Version)
+	switch {
+	case e.Event == eventStart:
+		return "Build started: " + what
+	case m.Status == runStatusCancelled:
+		return "Build cancelled: " + what
+	case e.Event == eventFailure:
+		return "Build failed: " + what
+	default:
+		return "Build succeeded: " + what
+	}
+}
+
+// eventFacts are the label/value pairs shown in chat messages, in display order
+func eventFacts(e BuildEvent) [][2]string {
+	m := e.Manifest
+	var facts [][2]string
+	add := func(label, value string) {
+		if value != "" {
+			facts = append(facts, [2]string{label, value})
+		}
+	}
+	add("Version", m.Version)
+	if m.BuildNumber > 0 {
+		add("Build", fmt.Sprint(m.BuildNumber))
+	}
+	add("Environment", m.Environment)
+	add("Branch", m.Branch)
+	if m.Commit != "" {
+		add("Commit", fmt.Sprintf("%.7s", m.Commit))
+	}
+	if m.Duration > 0 {
+		add("Duration", (time.Duration(m.Duration) * time.Second).String())
+	}
+	add("Run", m.RunID)
+	return facts
+}
+
+// eventArtifacts lists download links, or local artifact paths when nothing was uploaded
+func eventArtifacts(e BuildEvent) []string {
+	if len(e.Manifest.ArtifactLinks) > 0 {
+		return e.Manifest.ArtifactLinks
+	}
+	return e.Manifest.Artifacts
+}
+
+// eventNotes returns the plain-text release notes cut to a chat-friendly size
+func eventNotes(e BuildEvent) string {
+	if e.Manifest.ReleaseNotes == nil {
+		return ""
+	}
+	notes := e.Manifest.ReleaseNotes.Text()
+	if len(notes) > notifyMaxNotesChars {
+		notes = strings.ToValidUTF8(notes[:notifyMaxNotesChars], "") + "\n..."
+	}
+	return notes
+}
+
+// webhookPayload is the generic format: the whole manifest, for scripts and other services
+func webhookPayload(e BuildEvent) map[string]any {
+	return map[string]any{
+		"event":     e.Event,
+		"summary":   eventTitle(e),
+		"run":       e.Manifest,
+		"log_path":  e.LogPath,
+		"artifacts": eventArtifacts(e),
+	}
+}
+
+// slackPayload builds a Block Kit message for a Slack incoming webhook
+func slackPayload(e BuildEvent) map[string]any {
+	title := eventTitle(e)
+	var fields []map[string]any
+	for _, f := range eventFacts(e) {
+		fields = append(fields, map[string]any{"type": "mrkdwn", "text": fmt.Sprintf("*%s*\n%s", f[0], f[1])})
+	}
+	blocks := []map[string]any{
+		{"type": "header", "text": map[string]any{"type": "plain_text", "text": title}},
+		{"type": "section", "fields": fields},
+	}
+	section := func(text string) {
+		blocks = append(blocks, map[string]any{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": text}})
+	}
+	if e.Manifest.Error != "" {
+		section(fmt.Sprintf("*Reason*\n```%s```", e.Manifest.Error))
+	}
+	if len(e.Manifest.LikelyCauses) > 0 {
+		section("*Likely cause*\n" + strings.Join(e.Manifest.LikelyCauses, "\n"))
+	}
+	if artifacts := eventArtifacts(e); len(artifacts) > 0 && e.Event == eventSuccess {
+		section("*Artifacts*\n" + strings.Join(artifacts, "\n"))
+	}
+	if notes := eventNotes(e); notes != "" && e.Event == eventSuccess {
+		section("*What's new*\n" + notes)
+	}
+	return map[string]any{"text": title, "blocks": blocks}
+}
+
+// teamsPayload builds an Adaptive Card message for a Teams workflow webhook
+func teamsPayload(e BuildEvent) map[string]any {
+	color := "Good"
+	if e.Event == eventFailure {
+		color = "Attention"
+	} else if e.Event == eventStart {
+		color = "Accent"
+	}
+	var facts []map[string]any
+	for _, f := range eventFacts(e) {
+		facts = append(facts, map[string]any{"title": f[0], "value": f[1]})
+	}
+	body := []map[string]any{
+		{"type": "TextBlock", "size": "Large", "weight": "Bolder", "color": color, "text": eventTitle(e), "wrap": true},
+		{"type": "FactSet", "facts": facts},
+	}
+	text := func(label, value string) {
+		body = append(body,
+			map[string]any{"type": "TextBlock", "weight": "Bolder", "text": label, "spacing": "Medium"},
+			map[string]any{"type": "TextBlock", "text": value, "wrap": true})
+	}
+	if e.Manifest.Error != "" {
+		text("Reason", e.Manifest.Error)
+	}
+	if len(e.Manifest.LikelyCauses) > 0 {
+		text("Likely cause", strings.Join(e.Manifest.LikelyCauses, "\n\n"))
+	}
+	if notes := eventNotes(e); notes != "" && e.Event == eventSuccess {
+		text("What's new", notes)
+	}
+
+	var actions []map[string]any
+	for _, link := range e.Manifest.ArtifactLinks {
+		actions = append(actions, map[string]any{"type": "Action.OpenUrl", "title": "Download", "url": link})
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if len(actions) > 0 {
+		card["actions"] = actions
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// capturedBodies are the request bodies a captureServer received
+type capturedBodies struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (c *capturedBodies) list() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.bodies)
+}
+
+// captureServer records the request bodies it receives and answers with the given statuses
+// in turn, repeating the last one
+func captureServer(t *testing.T, statuses ...int) (*httptest.Server, *capturedBodies) {
+	t.Helper()
+	captured := &capturedBodies{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured.mu.Lock()
+		captured.bodies = append(captured.bodies, string(body))
+		n := len(captured.bodies)
+		captured.mu.Unlock()
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status = statuses[min(n, len(statuses))-1]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, captured
+}
+
+func testEvent(event string) BuildEvent {
+	m := RunManifest{
+		RunID:       "20240501-101500-abcd",
+		Version:     "1.4.2",
+		BuildNumber: 42,
+		Platform:    "android",
+		Environment: "STAGING",
+		Branch:      "staging",
+		Duration:    125,
+	}
+	if event == eventFailure {
+		m.Status = runStatusFailed
+		m.Error = "gradle build failed: exit status 1"
+	} else {
+		m.Status = runStatusSucceeded
+		m.ArtifactLinks = []string{"https://drive.google.com/file/d/abc123/view"}
+	}
+	return BuildEvent{Event: event, Manifest: m, LogPath: "/tmp/build.log"}
+}
+
+func TestWebhookNotifierFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		event  string
+		want   []string
+	}{
+		{notifierWebhook, eventSuccess, []string{`"event":"success"`, `"version":"1.4.2"`, `"environment":"STAGING"`, `"duration_seconds":125`, "https://drive.google.com/file/d/abc123/view"}},
+		{notifierWebhook, eventFailure, []string{`"event":"failure"`, `"version":"1.4.2"`, `"environment":"STAGING"`, `"duration_seconds":125`, "gradle build failed: exit status 1"}},
+		{notifierSlack, eventSuccess, []string{"Build succeeded: android 1.4.2", "1.4.2", "STAGING", "2m5s", "https://drive.google.com/file/d/abc123/view"}},
+		{notifierSlack, eventFailure, []string{"Build failed: android 1.4.2", "1.4.2", "STAGING", "2m5s", "gradle build failed: exit status 1"}},
+		{notifierTeams, eventSuccess, []string{"AdaptiveCard", "1.4.2", "STAGING", "2m5s", `"url":"https://drive.google.com/file/d/abc123/view"`}},
+		{notifierTeams, eventFailure, []string{"AdaptiveCard", `"color":"Attention"`, "1.4.2", "STAGING", "2m5s", "gradle build failed: exit status 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.event, func(t *testing.T) {
+			server, bodies := captureServer(t)
+			n := &webhookNotifier{format: tt.format, url: server.URL}
+			if err := n.Notify(context.Background(), testEvent(tt.event)); err != nil {
+				t.Fatal(err)
+			}
+			got := bodies.list()
+			if len(got) != 1 {
+				t.Fatalf("got %d requests, want 1", len(got))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got[0], want) {
+					t.Errorf("payload lacks %q:\n%s", want, got[0])
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookURLExpandsEnvironment(t *testing.T) {
+	server, bodies := captureServer(t)
+	t.Setenv("RN_BUILDER_TEST_HOOK", strings.TrimPrefix(server.URL, "http://"))
+	n := &webhookNotifier{format: notifierWebhook, url: "http://${RN_BUILDER_TEST_HOOK}/hook"}
+	if err := n.Notify(context.Background(), testEvent(eventSuccess)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(bodies.list()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestNotifierFilterWants(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter notifierFilter
+		event  string
+		env    string
+		want   bool
+	}{
+		{"no filter", notifierFilter{}, eventStart, "", true},
+		{"event listed", notifierFilter{events: []string{eventFailure}}, eventFailure, "PROD", true},
+		{"event not listed", notifierFilter{events: []string{eventFailure}}, eventSuccess, "PROD", false},
+		{"environment matches case-insensitively", notifierFilter{environments: []string{"prod"}}, eventSuccess, "PROD", true},
+		{"other environment", notifierFilter{environments: []string{"PROD"}}, eventSuccess, "STAGING", false},
+		{"start has no environment yet", notifierFilter{environments: []string{"PROD"}}, eventStart, "", false},
+		{"both must match", notifierFilter{events: []string{eventSuccess}, environments: []string{"PROD"}}, eventFailure, "PROD", false},
+	}
+	for _, tt := range tests {
+		e := BuildEvent{Event: tt.event, Manifest: RunManifest{Environment: tt.env}}
+		if got := tt.filter.Wants(e); got != tt.want {
+			t.Errorf("%s: Wants = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPostJSONRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		ok       bool
+	}{
+		{"success", []int{http.StatusOK}, 1, true},
+		{"5xx then success", []int{http.StatusServiceUnavailable, http.StatusOK}, 2, true},
+		{"5xx twice", []int{http.StatusBadGateway}, 2, false},
+		{"4xx is not retried", []int{http.StatusBadRequest}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, bodies := captureServer(t, tt.statuses...)
+			err := postJSON(context.Background(), server.URL, []byte(`{}`))
+			if (err == nil) != tt.ok {
+				t.Errorf("err = %v, want ok = %v", err, tt.ok)
+			}
+			if got := len(bodies.list()); got != tt.requests {
+				t.Errorf("got %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestPostJSONRetriesNetworkErrors(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			// Drop the first connection without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+	if err := postJSON(context.Background(), server.URL, []byte(`{}`)); err != nil {
+		t.Errorf("postJSON after a dropped connection: %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("got %d requests, want 2", hits.Load())
+	}
+}
+
+func TestNewNotifiersValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  NotifierConfig
+		wantErr string
+	}{
+		{"unknown type", NotifierConfig{Type: "pager", URL: "https://example.com"}, "unknown type 'pager'"},
+		{"unknown event", NotifierConfig{Type: notifierSlack, URL: "https://example.com", Events: []string{"finish"}}, "unknown event 'finish'"},
+		{"missing url", NotifierConfig{Type: notifierTeams}, "url is required"},
+	}
+	for _, tt := range tests {
+		_, err := newNotifiers([]NotifierConfig{tt.config})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	notifiers, err := newNotifiers([]NotifierConfig{
+		{Type: notifierWebhook, URL: "https://example.com/hook", Events: []string{eventSuccess, eventFailure}},
+		{Type: notifierSlack, URL: "https://hooks.slack.com/x", Environments: []string{"PROD"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifiers) != 2 || notifiers[0].Name() != notifierWebhook || notifiers[1].Name() != notifierSlack {
+		t.Errorf("notifiers = %v", notifiers)
+	}
+}
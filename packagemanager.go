@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PackageManager describes how to install JS dependencies for a project
+type PackageManager struct {
+	Name     string   // npm, yarn, pnpm or bun
+	Lockfile string   // Lockfile name relative to the project root ("" if none exists)
+	Install  []string // Frozen/CI install command (first element is the executable)
+	Reason   string   // Why this package manager was chosen, for the log
+}
+
+// lockfilePriority lists lockfiles in the order they are checked
+var lockfilePriority = []struct {
+	name    string
+	manager string
+}{
+	{"bun.lockb", "bun"},
+	{"bun.lock", "bun"},
+	{"pnpm-lock.yaml", "pnpm"},
+	{"yarn.lock", "yarn"},
+	{"package-lock.json", "npm"},
+	{"npm-shrinkwrap.json", "npm"},
+}
+
+// readPackageManagerField returns the "packageManager" field of package.json, e.g. "pnpm@8.15.1"
+func readPackageManagerField(rootPath string) string {
+	data, err := os.ReadFile(filepath.Join(rootPath, "package.json"))
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		PackageManager string `json:"packageManager"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return ""
+	}
+	return pkg.PackageManager
+}
+
+// detectPackageManager picks the package manager from the config override, the
+// packageManager field in package.json, or the lockfile present in rootPath
+func detectPackageManager(rootPath, override string) (*PackageManager, error) {
+	pm := &PackageManager{}
+	field := readPackageManagerField(rootPath)
+	fieldName, fieldVersion, _ := strings.Cut(field, "@")
+
+	switch {
+	case override != "":
+		pm.Name = strings.ToLower(override)
+		pm.Reason = "package_manager set in config"
+	case fieldName != "":
+		pm.Name = fieldName
+		pm.Reason = fmt.Sprintf("packageManager field in package.json (%s)", field)
+	}
+
+	var found []string
+	for _, lf := range lockfilePriority {
+		if _, err := os.Stat(filepath.Join(rootPath, lf.name)); err != nil {
+			continue
+		}
+		found = append(found, lf.name)
+		if pm.Name == "" {
+			pm.Name = lf.manager
+			pm.Reason = "found " + lf.name
+		}
+		if pm.Lockfile == "" && lf.manager == pm.Name {
+			pm.Lockfile = lf.name
+		}
+	}
+	if len(found) > 1 {
+		pm.Reason += fmt.Sprintf(" (warning: multiple lockfiles present: %s)", strings.Join(found, ", "))
+	}
+	if pm.Name == "" {
+		pm.Name = "npm"
+		pm.Reason = "no lockfile or packageManager field, defaulting to npm"
+	}
+
+	switch pm.Name {
+	case "npm":
+		if pm.Lockfile == "" {
+			pm.Install = []string{"npm", "install"} // npm ci requires a lockfile
+		} else {
+			pm.Install = []string{"npm", "ci"}
+		}
+	case "yarn":
+		if isYarnBerry(rootPath, fieldName, fieldVersion) {
+			pm.Install = []string{"yarn", "install", "--immutable"}
+		} else {
+			pm.Install = []string{"yarn", "install", "--frozen-lockfile"}
+		}
+	case "pnpm":
+		pm.Install = []string{"pnpm", "install", "--frozen-lockfile"}
+	case "bun":
+		pm.Install = []string{"bun", "install", "--frozen-lockfile"}
+	default:
+		return nil, fmt.Errorf("unsupported package manager '%s' (expected npm, yarn, pnpm or bun)", pm.Name)
+	}
+	return pm, nil
+}
+
+// isYarnBerry reports whether the project uses Yarn 2+ (which replaced --frozen-lockfile with --immutable)
+func isYarnBerry(rootPath, fieldName, fieldVersion string) bool {
+	if fieldName == "yarn" && fieldVersion != "" && !strings.HasPrefix(fieldVersion, "1.") {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(rootPath, ".yarnrc.yml"))
+	return err == nil
+}
+
+// installJSDependencies runs the frozen install and fails if the lockfile changed anyway
+func installJSDependencies(config Config, pm *PackageManager, logOutput io.Writer) error {
+	if pm.Lockfile == "" {
+		fmt.Fprintf(logOutput, "Warning: no %s lockfile found, dependency versions are not pinned\n", pm.Name)
+	}
+
+	var err error
+	var lockBefore []byte
+	lockPath := filepath.Join(config.RootPath, pm.Lockfile)
+	if pm.Lockfile != "" {
+		if lockBefore, err = os.ReadFile(lockPath); err != nil {
+			return fmt.Errorf("failed to read %s: %w", pm.Lockfile, err)
+		}
+	}
+
+	fmt.Fprintf(logOutput, "Installing JS dependencies with '%s'...\n", strings.Join(pm.Install, " "))
+	if err := runCmd(logOutput, true, config.RootPath, pm.Install[0], pm.Install[1:]...); err != nil {
+		return fmt.Errorf("%s install failed (lockfile out of date? run '%s install' locally and commit %s): %w", pm.Name, pm.Name, pm.Lockfile, err)
+	}
+
+	if pm.Lockfile != "" {
+		lockAfter, err := os.ReadFile(lockPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s after install: %w", pm.Lockfile, err)
+		}
+		if !bytes.Equal(lockBefore, lockAfter) {
+			return fmt.Errorf("%s was modified by '%s'; commit an up-to-date lockfile", pm.Lockfile, strings.Join(pm.Install, " "))
+		}
+	}
+	return nil
+}
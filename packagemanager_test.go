@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectPackageManager(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string // Files in the project root
+		override    string
+		wantName    string
+		wantLock    string
+		wantInstall string
+		wantReason  string // Substring of the reason
+		wantErr     bool
+	}{
+		{
+			name:        "no lockfile defaults to npm install",
+			files:       map[string]string{"package.json": `{}`},
+			wantName:    "npm",
+			wantInstall: "npm install",
+			wantReason:  "defaulting to npm",
+		},
+		{
+			name:        "npm lockfile",
+			files:       map[string]string{"package-lock.json": "{}"},
+			wantName:    "npm",
+			wantLock:    "package-lock.json",
+			wantInstall: "npm ci",
+		},
+		{
+			name:        "yarn classic",
+			files:       map[string]string{"yarn.lock": ""},
+			wantName:    "yarn",
+			wantLock:    "yarn.lock",
+			wantInstall: "yarn install --frozen-lockfile",
+		},
+		{
+			name:        "yarn berry from .yarnrc.yml",
+			files:       map[string]string{"yarn.lock": "", ".yarnrc.yml": "nodeLinker: node-modules\n"},
+			wantName:    "yarn",
+			wantLock:    "yarn.lock",
+			wantInstall: "yarn install --immutable",
+		},
+		{
+			name:        "yarn berry from the packageManager field",
+			files:       map[string]string{"package.json": `{"packageManager": "yarn@4.1.0"}`, "yarn.lock": ""},
+			wantName:    "yarn",
+			wantLock:    "yarn.lock",
+			wantInstall: "yarn install --immutable",
+		},
+		{
+			name:        "pnpm",
+			files:       map[string]string{"pnpm-lock.yaml": ""},
+			wantName:    "pnpm",
+			wantLock:    "pnpm-lock.yaml",
+			wantInstall: "pnpm install --frozen-lockfile",
+		},
+		{
+			name:        "bun text lockfile",
+			files:       map[string]string{"bun.lock": ""},
+			wantName:    "bun",
+			wantLock:    "bun.lock",
+			wantInstall: "bun install --frozen-lockfile",
+		},
+		{
+			name:        "lockfile priority with several lockfiles",
+			files:       map[string]string{"yarn.lock": "", "package-lock.json": "{}", "pnpm-lock.yaml": ""},
+			wantName:    "pnpm",
+			wantLock:    "pnpm-lock.yaml",
+			wantInstall: "pnpm install --frozen-lockfile",
+			wantReason:  "multiple lockfiles present: pnpm-lock.yaml, yarn.lock, package-lock.json",
+		},
+		{
+			name:        "packageManager field beats lockfile priority",
+			files:       map[string]string{"package.json": `{"packageManager": "yarn@1.22.19"}`, "yarn.lock": "", "pnpm-lock.yaml": ""},
+			wantName:    "yarn",
+			wantLock:    "yarn.lock",
+			wantInstall: "yarn install --frozen-lockfile",
+			wantReason:  "packageManager field in package.json (yarn@1.22.19) (warning: multiple lockfiles",
+		},
+		{
+			name:        "packageManager field without its lockfile",
+			files:       map[string]string{"package.json": `{"packageManager": "npm@10.2.0"}`, "yarn.lock": ""},
+			wantName:    "npm",
+			wantInstall: "npm install",
+			wantReason:  "packageManager field",
+		},
+		{
+			name:        "override beats the packageManager field",
+			files:       map[string]string{"package.json": `{"packageManager": "yarn@4.1.0"}`, "yarn.lock": "", "package-lock.json": "{}"},
+			override:    "NPM",
+			wantName:    "npm",
+			wantLock:    "package-lock.json",
+			wantInstall: "npm ci",
+			wantReason:  "package_manager set in config",
+		},
+		{
+			name:     "unsupported override",
+			files:    map[string]string{"yarn.lock": ""},
+			override: "deno",
+			wantErr:  true,
+		},
+		{
+			name:    "unsupported packageManager field",
+			files:   map[string]string{"package.json": `{"packageManager": "cnpm@9.0.0"}`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pm, err := detectPackageManager(root, tt.override)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("detected %+v, want an error", pm)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pm.Name != tt.wantName || pm.Lockfile != tt.wantLock {
+				t.Errorf("detected %s with lockfile %q, want %s with %q", pm.Name, pm.Lockfile, tt.wantName, tt.wantLock)
+			}
+			if got := strings.Join(pm.Install, " "); got != tt.wantInstall {
+				t.Errorf("install = %q, want %q", got, tt.wantInstall)
+			}
+			if !strings.Contains(pm.Reason, tt.wantReason) {
+				t.Errorf("reason = %q, want it to contain %q", pm.Reason, tt.wantReason)
+			}
+			if len(tt.files) < 2 && strings.Contains(pm.Reason, "multiple lockfiles") {
+				t.Errorf("reason warns about multiple lockfiles: %q", pm.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Per-platform outcomes recorded in the manifest
+const (
+	platformSucceeded = "succeeded"
+	platformFailed    = "failed"
+	platformCancelled = "cancelled"
+)
+
+// platformBuild is what each platform pipeline needs from the shared setup steps
+type platformBuild struct {
+	config      Config
+	buildNumber int
+	branch      string
+	notes       *ReleaseNotes
+	touched     *fileSnapshot
+	manifest    *RunManifest
+	artifactDir string // Run folder the artifacts are moved into
+
+	mu sync.Mutex // Guards manifest fields written by the pipelines
+}
+
+// record stores a pipeline's artifact, download link and outcome in the manifest
+func (b *platformBuild) record(platform, status, artifact, link string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if artifact != "" {
+		b.manifest.Artifacts = append(b.manifest.Artifacts, artifact)
+	}
+	if link != "" {
+		b.manifest.ArtifactLinks = append(b.manifest.ArtifactLinks, link)
+	}
+	if status != "" {
+		if b.manifest.PlatformStatus == nil {
+			b.manifest.PlatformStatus = make(map[string]string)
+		}
+		b.manifest.PlatformStatus[platform] = status
+	}
+}
+
+// runAndroid builds the APK and uploads it to Google Drive as soon as it is ready
+func (b *platformBuild) runAndroid(logOutput io.Writer) error {
+	if err := checkCancelled(logOutput); err != nil {
+		return err
+	}
+	apkPath, err := buildAndroidGUI(b.config, b.buildNumber, b.branch == "main", b.touched, logOutput)
+	if err != nil {
+		return fmt.Errorf("android build failed: %w", err)
+	}
+	if apkPath, err = keepArtifact(apkPath, b.artifactDir, logOutput); err != nil {
+		return err
+	}
+	b.record("android", "", apkPath, "")
+
+	if err := checkCancelled(logOutput); err != nil {
+		return err
+	}
+	setLogStep(logOutput, "upload")
+	switch {
+	case b.config.SkipUpload:
+		fmt.Fprintf(logOutput, "Skipping Google Drive upload.\n")
+	case b.config.DriveFolderID == "" || b.config.GoogleCredentials == "":
+		fmt.Fprintf(logOutput, "Skipping Google Drive upload: Drive Folder ID or Google Credentials Path not provided.\n")
+	default:
+		link, err := uploadToGoogleDriveWithAPIGUI(b.config, apkPath, driveDescription(b.manifest), logOutput)
+		if err != nil {
+			return fmt.Errorf("google drive upload failed: %w", err)
+		}
+		b.record("android", "", "", link)
+	}
+	return nil
+}
+
+// runIOS installs pods, builds the IPA and uploads it to TestFlight as soon as it is ready
+func (b *platformBuild) runIOS(logOutput io.Writer) error {
+	// CocoaPods needs the ios/ directory prebuild produced
+	if err := checkCancelled(logOutput); err != nil {
+		return err
+	}
+	setLogStep(logOutput, "pods")
+	if !b.config.SkipDeps {
+		if err := installPodsGUI(b.config, b.touched, logOutput); err != nil {
+			return fmt.Errorf("error installing pods: %w", err)
+		}
+	} else {
+		fmt.Fprintf(logOutput, "Skipping pod install.\n")
+	}
+
+	if err := checkCancelled(logOutput); err != nil {
+		return err
+	}
+	ipaPath, err := buildIOSGUI(b.config, b.buildNumber, b.branch, b.touched, logOutput)
+	if err != nil {
+		return fmt.Errorf("ios build failed: %w", err)
+	}
+	if ipaPath, err = keepArtifact(ipaPath, b.artifactDir, logOutput); err != nil {
+		return err
+	}
+	b.record("ios", "", ipaPath, "")
+	if b.notes != nil {
+		if err := writeWhatToTest(filepath.Dir(ipaPath), b.notes, logOutput); err != nil {
+			fmt.Fprintf(logOutput, "Warning: %v\n", err)
+		}
+	}
+
+	if err := checkCancelled(logOutput); err != nil {
+		return err
+	}
+	setLogStep(logOutput, "upload")
+	if b.config.SkipUpload || runtime.GOOS != "darwin" {
+		fmt.Fprintf(logOutput, "Skipping TestFlight upload.\n")
+		return nil
+	}
+	if err := uploadToTestFlightGUI(b.config, b.branch == "main", ipaPath, logOutput); err != nil {
+		return fmt.Errorf("test flight upload failed: %w", err)
+	}
+	if b.notes == nil {
+		return nil
+	}
+	if !b.config.AppStoreConnect.configured() {
+		fmt.Fprintf(logOutput, "TestFlight What to Test not set: add app_store_connect to the config, or paste %s in App Store Connect\n", whatToTestFile)
+		return nil
+	}
+	// The upload succeeded; a missing What to Test is not worth failing the build over
+	if err := setTestFlightWhatToTest(b.config, b.buildNumber, b.notes, logOutput); err != nil {
+		fmt.Fprintf(logOutput, "Warning: failed to set TestFlight What to Test: %v\n", err)
+	}
+	return nil
+}
+
+// runPlatformPipelines runs each platform's build and upload. With more than one
+// platform they run in parallel, each logging through its own forked logger. A failure
+// leaves the other platform running unless fail_fast is set.
+func runPlatformPipelines(b *platformBuild, platforms []string, logOutput io.Writer) error {
+	pipelines := map[string]func(io.Writer) error{"android": b.runAndroid, "ios": b.runIOS}
+	parent, ok := logOutput.(*RunLogger)
+	if len(platforms) == 1 || !ok {
+		// One platform (or a plain writer): run in order, stopping at the first failure
+		for _, platform := range platforms {
+			if err := pipelines[platform](logOutput); err != nil {
+				b.record(platform, pipelineStatus(err, logOutput), "", "")
+				return err
+			}
+			b.record(platform, platformSucceeded, "", "")
+		}
+		return nil
+	}
+
+	fmt.Fprintf(logOutput, "Building %v in parallel\n", platforms)
+	parent.SetStep("") // Each platform's steps are tracked on its own logger
+	ctx, stopOthers := context.WithCancel(parent.Context())
+	defer stopOthers()
+	var (
+		wg       sync.WaitGroup
+		failMu   sync.Mutex
+		failedBy string // First platform to fail, when fail_fast stopped the others
+	)
+	errs := make([]error, len(platforms))
+	for i, platform := range platforms {
+		logger := parent.Fork(platform)
+		logger.SetContext(ctx)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pipelines[platform](logger)
+			logger.EndStep(err)
+			failMu.Lock()
+			defer failMu.Unlock()
+			switch {
+			case err == nil:
+				b.record(platform, platformSucceeded, "", "")
+			case failedBy != "" && parent.Context().Err() == nil:
+				// Stopped because another platform failed; that failure is the one reported
+				b.record(platform, platformCancelled, "", "")
+				fmt.Fprintf(logger, "Stopped because the %s build failed (fail_fast)\n", failedBy)
+			default:
+				errs[i] = err
+				b.record(platform, pipelineStatus(err, logger), "", "")
+				if b.config.FailFast && failedBy == "" && parent.Context().Err() == nil {
+					failedBy = platform
+					stopOthers()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// pipelineStatus maps a pipeline error to the platform status
+func pipelineStatus(err error, logOutput io.Writer) string {
+	if errors.Is(err, errBuildCancelled) || logContext(logOutput).Err() != nil {
+		return platformCancelled
+	}
+	return platformFailed
+}
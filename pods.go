@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Output that means the local spec repo is too old for the Podfile.lock
+var podRepoOutdatedMarkers = []string{
+	"could not find compatible versions for pod",
+	"out-of-date source repos",
+	"Unable to find a specification for",
+	"pod repo update",
+}
+
+var gemfileCocoapodsRe = regexp.MustCompile(`(?m)^\s*gem\s+['"]cocoapods['"]`)
+
+// findGemfile returns the Gemfile that pins CocoaPods for the project, checking ios/ then the root
+func findGemfile(rootPath string) string {
+	for _, dir := range []string{filepath.Join(rootPath, "ios"), rootPath} {
+		path := filepath.Join(dir, "Gemfile")
+		data, err := os.ReadFile(path)
+		if err == nil && gemfileCocoapodsRe.Match(data) {
+			return path
+		}
+	}
+	return ""
+}
+
+// podfileLockChecksum returns the PODFILE CHECKSUM recorded in Podfile.lock
+func podfileLockChecksum(lockPath string) (string, error) {
+	file, err := os.Open(lockPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "PODFILE CHECKSUM:"); ok {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("PODFILE CHECKSUM not found")
+}
+
+// podfileChecksum computes the checksum CocoaPods stores for a Podfile (SHA1 of its contents)
+func podfileChecksum(podfilePath string) (string, error) {
+	data, err := os.ReadFile(podfilePath)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha1.Sum(data)), nil
+}
+
+// checkPodfileLock warns when Podfile.lock was generated from a different Podfile
+func checkPodfileLock(iosDir string, logOutput io.Writer) {
+	lockPath := filepath.Join(iosDir, "Podfile.lock")
+	if _, err := os.Stat(lockPath); os.IsNotExist(err) {
+		fmt.Fprintln(logOutput, "Warning: no Podfile.lock found, pod versions are not pinned")
+		return
+	}
+	locked, err := podfileLockChecksum(lockPath)
+	if err != nil {
+		fmt.Fprintf(logOutput, "Warning: could not read Podfile.lock checksum: %v\n", err)
+		return
+	}
+	actual, err := podfileChecksum(filepath.Join(iosDir, "Podfile"))
+	if err != nil {
+		fmt.Fprintf(logOutput, "Warning: could not checksum Podfile: %v\n", err)
+		return
+	}
+	if locked != actual {
+		fmt.Fprintf(logOutput, "Warning: Podfile changed since Podfile.lock was generated (checksum %s, lock has %s); pod install will update Podfile.lock\n", actual, locked)
+	} else {
+		fmt.Fprintln(logOutput, "Podfile.lock checksum matches Podfile.")
+	}
+}
+
+// verifyPodsInSync checks that Pods/Manifest.lock matches Podfile.lock after an install,
+// which is the same check Xcode's "[CP] Check Pods Manifest.lock" phase does
+func verifyPodsInSync(iosDir string) error {
+	lock, err := os.ReadFile(filepath.Join(iosDir, "Podfile.lock"))
+	if err != nil {
+		return fmt.Errorf("failed to read Podfile.lock after pod install: %w", err)
+	}
+	manifest, err := os.ReadFile(filepath.Join(iosDir, "Pods", "Manifest.lock"))
+	if err != nil {
+		return fmt.Errorf("failed to read Pods/Manifest.lock after pod install: %w", err)
+	}
+	if !bytes.Equal(lock, manifest) {
+		return errors.New("Pods/Manifest.lock does not match Podfile.lock after pod install")
+	}
+	return nil
+}
+
+// runPodInstall runs pod install (through bundler when a Gemfile pins CocoaPods) and
+// retries once with --repo-update when the spec repo is out of date. The lockfiles these
+// rewrite are tracked in touched so the build leaves them as it found them.
+func runPodInstall(config Config, iosDir string, touched *fileSnapshot, logOutput io.Writer) error {
+	podCmd := "pod"
+	podArgs := []string{"install"}
+	if gemfile := findGemfile(config.RootPath); gemfile != "" {
+		fmt.Fprintf(logOutput, "Using Bundler for CocoaPods (%s)\n", gemfile)
+		gemDir := filepath.Dir(gemfile)
+		if err := runCmd(logOutput, true, gemDir, "bundle", "check"); err != nil {
+			fmt.Fprintln(logOutput, "Gems missing, running bundle install...")
+			if err := touched.Track(filepath.Join(gemDir, "Gemfile.lock")); err != nil {
+				return err
+			}
+			if err := runCmd(logOutput, true, gemDir, "bundle", "install"); err != nil {
+				return fmt.Errorf("bundle install failed: %w", err)
+			}
+		}
+		podCmd = "bundle"
+		podArgs = []string{"exec", "pod", "install"}
+	}
+
+	if err := touched.Track(filepath.Join(iosDir, "Podfile.lock")); err != nil {
+		return err
+	}
+	err := runCmd(logOutput, true, iosDir, podCmd, podArgs...)
+	var cmdErr *CommandError
+	if err != nil && errors.As(err, &cmdErr) && cmdErr.OutputContains(podRepoOutdatedMarkers...) {
+		fmt.Fprintln(logOutput, "CocoaPods spec repo looks out of date, retrying with --repo-update...")
+		err = runCmd(logOutput, true, iosDir, podCmd, append(podArgs, "--repo-update")...)
+	}
+	if err != nil {
+		return fmt.Errorf("pod install failed: %w", err)
+	}
+	return verifyPodsInSync(iosDir)
+}
+
+// installPodsGUI installs CocoaPods for the project unless the dependency cache says
+// nothing changed. It runs after prebuild, so ios/ must exist by now.
+func installPodsGUI(config Config, touched *fileSnapshot, logOutput io.Writer) error {
+	iosDir := filepath.Join(config.RootPath, "ios")
+	if _, err := os.Stat(iosDir); os.IsNotExist(err) {
+		return fmt.Errorf("'ios' directory not found in %s", config.RootPath)
+	}
+	if _, err := os.Stat(filepath.Join(iosDir, "Podfile")); os.IsNotExist(err) {
+		fmt.Fprintln(logOutput, "Skipping pod install: no Podfile in 'ios' directory")
+		return nil
+	}
+
+	cache := loadDepCache(config.RootPath, logOutput)
+	jsLockfile := "none"
+	if pm, err := detectPackageManager(config.RootPath, config.PackageManager); err == nil && pm.Lockfile != "" {
+		jsLockfile = pm.Lockfile + ":" + fileInput(filepath.Join(config.RootPath, pm.Lockfile))
+	}
+
+	// Pods depend on node_modules through autolinking, so the JS lockfile is an input too
+	podInputs := map[string]string{
+		"podfile":      fileInput(filepath.Join(iosDir, "Podfile")), // Prebuild regenerates it
+		"podfile_lock": fileInput(filepath.Join(iosDir, "Podfile.lock")),
+		"js_lockfile":  jsLockfile,
+		"node":         cache.nodeVersion,
+	}
+	_, manifestErr := os.Stat(filepath.Join(iosDir, "Pods", "Manifest.lock"))
+	install, reason := cache.decide(depGroupPods, podInputs, manifestErr == nil, config.ForceReinstall)
+	if !install {
+		fmt.Fprintf(logOutput, "Skipping pod install: %s\n", reason)
+		return nil
+	}
+	fmt.Fprintf(logOutput, "Installing CocoaPods dependencies: %s\n", reason)
+
+	checkPodfileLock(iosDir, logOutput)
+	if err := runPodInstall(config, iosDir, touched, logOutput); err != nil {
+		return err
+	}
+
+	// pod install may create or update Podfile.lock, so hash it again
+	podInputs["podfile_lock"] = fileInput(filepath.Join(iosDir, "Podfile.lock"))
+	if err := cache.record(depGroupPods, podInputs); err != nil {
+		fmt.Fprintf(logOutput, "Warning: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// selectedPlatforms validates the platform setting and returns the platforms this
+// machine will build, in build order (iOS is dropped off macOS)
+func selectedPlatforms(platform string, logOutput io.Writer) ([]string, error) {
+	var platforms []string
+	switch strings.ToLower(platform) {
+	case "all":
+		platforms = []string{"android", "ios"}
+	case "android":
+		platforms = []string{"android"}
+	case "ios":
+		platforms = []string{"ios"}
+	default:
+		return nil, fmt.Errorf("invalid platform specified: %s", platform)
+	}
+	if runtime.GOOS != "darwin" && platforms[len(platforms)-1] == "ios" {
+		fmt.Fprintf(logOutput, "Skipping iOS build: requires macOS\n")
+		platforms = platforms[:len(platforms)-1]
+	}
+	return platforms, nil
+}
+
+// runPrebuildPhase generates the native projects with expo prebuild, once per platform,
+// so native dependency installs and builds see the final android/ and ios/ directories.
+// Bare React Native projects build from their committed native projects, which must exist.
+func runPrebuildPhase(config Config, projectType string, platforms []string, logOutput io.Writer) error {
+	if projectType == projectTypeBare {
+		for _, platform := range platforms {
+			if _, err := os.Stat(filepath.Join(config.RootPath, platform)); err != nil {
+				return fmt.Errorf("bare React Native project has no '%s' directory; commit the native project or set project_type: expo", platform)
+			}
+		}
+		fmt.Fprintln(logOutput, "Skipping expo prebuild: bare React Native project, using committed native projects")
+		return nil
+	}
+
+	for _, platform := range platforms {
+		args := []string{"expo", "prebuild", "--platform", platform, "--no-install"}
+		if config.CleanPrebuild {
+			args = append(args, "--clean")
+		}
+		fmt.Fprintf(logOutput, "Running expo prebuild for %s...\n", platform)
+		if err := runCmd(logOutput, true, config.RootPath, "npx", args...); err != nil {
+			return fmt.Errorf("expo prebuild failed for %s: %w", platform, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows; cancelling kills the PowerShell process only
+func setProcessGroup(cmd *exec.Cmd) {}
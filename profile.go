@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var profileNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// profileLoader turns the profile named in a build request into a config. A profile is
+// <name>.yaml in dir; no profile means the default config file.
+type profileLoader struct {
+	configPath string // Default profile
+	dir        string // <profile>.yaml files
+	logDir     string // Forced on every profile so all runs can be listed in one place
+}
+
+func newProfileLoader(configPath, dir, logDir string) profileLoader {
+	if dir == "" {
+		dir = filepath.Dir(configPath)
+	}
+	return profileLoader{configPath: configPath, dir: dir, logDir: logDir}
+}
+
+// load reads the config for a build request
+func (p profileLoader) load(req BuildRequest) (Config, error) {
+	path := p.configPath
+	if req.Profile != "" {
+		if !profileNameRe.MatchString(req.Profile) {
+			return Config{}, fmt.Errorf("invalid profile name '%s'", req.Profile)
+		}
+		path = filepath.Join(p.dir, req.Profile+".yaml")
+		if _, err := os.Stat(path); err != nil {
+			return Config{}, fmt.Errorf("unknown profile '%s'", req.Profile)
+		}
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LogDir = p.logDir
+	return *config, nil
+}
+
+// list returns the profiles in dir: <name>.yaml files other than the default config that
+// load as a config with a root_path, which leaves out rule files and the like
+func (p profileLoader) list() []string {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil
+	}
+	defaultPath, _ := filepath.Abs(p.configPath)
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || entry.IsDir() || !profileNameRe.MatchString(name) {
+			continue
+		}
+		path, _ := filepath.Abs(filepath.Join(p.dir, entry.Name()))
+		if path == defaultPath {
+			continue
+		}
+		if config, err := LoadConfig(path); err == nil && config.RootPath != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
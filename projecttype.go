@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Project types rn-builder knows how to build
+const (
+	projectTypeExpo = "expo" // Native projects are generated by expo prebuild
+	projectTypeBare = "bare" // React Native CLI app with committed android/ and ios/
+)
+
+// appConfigFiles are the Expo dynamic/static config files, any of which marks an Expo project
+var appConfigFiles = []string{"app.config.js", "app.config.ts", "app.config.mjs", "app.config.cjs", "app.config.json"}
+
+// packageJSON holds the package.json fields used for project detection
+type packageJSON struct {
+	Version         string            `json:"version"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+// hasDependency reports whether name is listed in dependencies or devDependencies
+func (p *packageJSON) hasDependency(name string) bool {
+	_, dep := p.Dependencies[name]
+	_, devDep := p.DevDependencies[name]
+	return dep || devDep
+}
+
+// readPackageJSON parses package.json in rootPath
+func readPackageJSON(rootPath string) (*packageJSON, error) {
+	data, err := os.ReadFile(filepath.Join(rootPath, "package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json: %w", err)
+	}
+	return &pkg, nil
+}
+
+// appJSONHasExpoKey reports whether app.json has a top-level "expo" object
+func appJSONHasExpoKey(rootPath string) bool {
+	data, err := os.ReadFile(filepath.Join(rootPath, "app.json"))
+	if err != nil {
+		return false
+	}
+	var appJSON map[string]json.RawMessage
+	if err := json.Unmarshal(data, &appJSON); err != nil {
+		return false
+	}
+	_, ok := appJSON["expo"]
+	return ok
+}
+
+// detectProjectType works out whether rootPath is an Expo or a bare React Native
+// project, from the config override, package.json dependencies and the app config files
+func detectProjectType(rootPath, override string) (projectType string, reason string, err error) {
+	switch strings.ToLower(override) {
+	case "":
+	case projectTypeExpo, projectTypeBare:
+		return strings.ToLower(override), "project_type set in config", nil
+	default:
+		return "", "", fmt.Errorf("unsupported project type '%s' (expected expo or bare)", override)
+	}
+
+	pkg, err := readPackageJSON(rootPath)
+	if err != nil {
+		return "", "", err
+	}
+	if pkg.hasDependency("expo") {
+		return projectTypeExpo, "expo is a dependency in package.json", nil
+	}
+	for _, name := range appConfigFiles {
+		if _, err := os.Stat(filepath.Join(rootPath, name)); err == nil {
+			return projectTypeExpo, "found " + name, nil
+		}
+	}
+	if appJSONHasExpoKey(rootPath) {
+		return projectTypeExpo, "app.json has an \"expo\" section", nil
+	}
+	if pkg.hasDependency("react-native") {
+		return projectTypeBare, "react-native without expo in package.json", nil
+	}
+	return "", "", fmt.Errorf("%s does not look like a React Native project (no react-native or expo dependency in package.json)", rootPath)
+}
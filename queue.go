@@ -0,0 +1,541 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jobStatusQueued  = "queued"
+	jobStatusRunning = "running"
+	maxFinishedJobs  = 100 // Finished jobs kept in the queue; their runs stay in the log dir
+	queueStateFile   = "queue.json"
+)
+
+// Build triggers recorded in the run manifest; scheduled builds use "schedule:<name>"
+const (
+	triggerManual   = "manual" // Run Build in the GUI
+	triggerCLI      = "cli"
+	triggerAPI      = "api"
+	triggerWatch    = "watch"
+	triggerSchedule = "schedule"
+)
+
+// QueueLimits caps how many builds of each platform run at once (0 = 1)
+type QueueLimits struct {
+	Android int `yaml:"android"` // Concurrent Android (Gradle) builds
+	IOS     int `yaml:"ios"`     // Concurrent iOS builds; keep at 1 unless each build has its own Xcode
+}
+
+func (l QueueLimits) limit(platform string) int {
+	n := l.Android
+	if platform == "ios" {
+		n = l.IOS
+	}
+	return max(n, 1)
+}
+
+// BuildRequest asks for a build of a profile with optional overrides
+type BuildRequest struct {
+	Profile  string `json:"profile,omitempty"`  // Config profile; empty means the default config
+	Platform string `json:"platform,omitempty"` // all, android or ios
+	Version  string `json:"version,omitempty"`  // X.Y.Z or X.Y.Z-rc.N
+	Ref      string `json:"ref,omitempty"`      // Branch, tag or SHA to build in a worktree
+	Branch   string `json:"branch,omitempty"`   // Branch whose environment to build
+	Trigger  string `json:"trigger,omitempty"`  // What submitted the request; set by the submitter, not API clients
+}
+
+// apply copies the request's overrides onto config and validates the result
+func (req BuildRequest) apply(config *Config) error {
+	if req.Platform != "" {
+		switch strings.ToLower(req.Platform) {
+		case "all", "android", "ios":
+			config.Platform = strings.ToLower(req.Platform)
+		default:
+			return fmt.Errorf("invalid platform '%s' (expected all, android or ios)", req.Platform)
+		}
+	}
+	if req.Version != "" {
+		config.BuildVersion = req.Version
+	}
+	if req.Ref != "" {
+		config.Ref = req.Ref
+	}
+	if req.Branch != "" {
+		config.Branch = req.Branch
+	}
+	if req.Trigger != "" {
+		config.Trigger = req.Trigger
+	}
+	readsVersion := config.VersionSource != "" && config.VersionSource != versionSourceConfig
+	if !readsVersion && !isValidVersion(config.BuildVersion) {
+		return fmt.Errorf("invalid build version '%s' (expected X.Y.Z or X.Y.Z-rc.N)", config.BuildVersion)
+	}
+	return nil
+}
+
+// Job is a queued or finished build request. A finished job takes the status of its run.
+type Job struct {
+	ID          string       `json:"id"`
+	Request     BuildRequest `json:"request"`
+	Workspace   string       `json:"workspace"` // Absolute root path; one build at a time per workspace
+	Platforms   []string     `json:"platforms"` // Platform slots the build occupies
+	Version     string       `json:"version,omitempty"`
+	Status      string       `json:"status"`
+	RunID       string       `json:"run_id,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	SubmittedAt time.Time    `json:"submitted_at"`
+	StartedAt   time.Time    `json:"started_at,omitempty"`
+	FinishedAt  time.Time    `json:"finished_at,omitempty"`
+	Interrupted bool         `json:"interrupted,omitempty"` // Stopped by a shutdown (or crash) rather than run to the end
+
+	config          Config
+	run             *BuildRun
+	cancelRequested bool // Cancel arrived while the run was being created
+}
+
+func (j *Job) finished() bool {
+	return j.Status != jobStatusQueued && j.Status != jobStatusRunning
+}
+
+// LogPath returns the log file of the job's run, or "" before it started
+func (j Job) LogPath() string {
+	logDir, err := resolveLogDir(j.config)
+	if err != nil || j.RunID == "" {
+		return ""
+	}
+	return filepath.Join(logDir, j.RunID, runLogFile)
+}
+
+// persistedJob is a job as stored in the queue file, with the config it builds
+type persistedJob struct {
+	Job
+	Config Config `json:"config"`
+}
+
+// BuildQueue runs submitted builds in order, at most one per workspace and within the
+// per-platform limits. Queued jobs never overtake an earlier job that waits for the same
+// workspace or platform. The queue is saved to a file after every change.
+type BuildQueue struct {
+	mu        sync.Mutex
+	jobs      []*Job // Submission order, as reordered by Move
+	wg        sync.WaitGroup
+	closed    bool
+	started   bool
+	limits    QueueLimits
+	statePath string
+	resolve   func(BuildRequest) (Config, error)
+	sinks     []LogSink
+
+	OnChange func()           // Called after jobs change (not holding the queue lock); set before Start
+	OnFinish func(Job, error) // Called when a run ends, with the error Execute returned
+}
+
+// NewBuildQueue creates a queue persisted at statePath, restoring the jobs saved there.
+// resolve turns a profile request into a config (nil if only Enqueue is used) and sinks
+// receive the log records of every run. Nothing runs until Start.
+func NewBuildQueue(statePath string, limits QueueLimits, resolve func(BuildRequest) (Config, error), sinks ...LogSink) (*BuildQueue, error) {
+	q := &BuildQueue{limits: limits, statePath: statePath, resolve: resolve, sinks: sinks}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// queueStatePath returns the default queue file for a queue owner (serve, gui, ...)
+func queueStatePath(owner string) (string, error) {
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, owner+"-"+queueStateFile), nil
+}
+
+// load restores saved jobs. Builds that were running when the process stopped are
+// marked failed, as is their run manifest.
+func (q *BuildQueue) load() error {
+	data, err := os.ReadFile(q.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read queue file: %w", err)
+	}
+	var saved []persistedJob
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse queue file %s: %w", q.statePath, err)
+	}
+	for _, p := range saved {
+		job := p.Job
+		job.config = p.Config
+		if job.Status == jobStatusRunning {
+			job.Status = runStatusFailed
+			job.Interrupted = true
+			job.Error = "interrupted: rn-builder stopped while the build was running"
+			job.FinishedAt = time.Now()
+			markRunInterrupted(job.config, job.RunID, job.Error)
+		}
+		q.jobs = append(q.jobs, &job)
+	}
+	return nil
+}
+
+// markRunInterrupted fixes the manifest of a run that never finished
+func markRunInterrupted(config Config, runID, reason string) {
+	logDir, err := resolveLogDir(config)
+	if err != nil || runID == "" {
+		return
+	}
+	dir := filepath.Join(logDir, runID)
+	m, err := LoadRunManifest(dir)
+	if err != nil || m.Status != runStatusRunning {
+		return
+	}
+	m.Status = runStatusFailed
+	m.Error = reason
+	m.Save(dir)
+}
+
+// saveLocked writes the queue file; q.mu must be held
+func (q *BuildQueue) saveLocked() error {
+	saved := make([]persistedJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		saved = append(saved, persistedJob{Job: *job, Config: job.config})
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode queue: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(q.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	// Write then rename, so a crash never leaves a half-written queue
+	tmp := q.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+	if err := os.Rename(tmp, q.statePath); err != nil {
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+	return nil
+}
+
+// changedLocked saves the queue and starts whatever can run now; q.mu must be held.
+// Callers call q.changed() after unlocking.
+func (q *BuildQueue) changedLocked() {
+	if err := q.saveLocked(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	q.dispatchLocked()
+}
+
+func (q *BuildQueue) changed() {
+	if q.OnChange != nil {
+		q.OnChange()
+	}
+}
+
+// Start begins running queued jobs, including ones restored from the queue file
+func (q *BuildQueue) Start() {
+	q.mu.Lock()
+	q.started = true
+	q.changedLocked()
+	q.mu.Unlock()
+	q.changed()
+}
+
+// Submit resolves a profile request and queues it
+func (q *BuildQueue) Submit(req BuildRequest) (Job, error) {
+	if q.resolve == nil {
+		return Job{}, errors.New("this queue does not support profiles")
+	}
+	config, err := q.resolve(req)
+	if err != nil {
+		return Job{}, err
+	}
+	return q.Enqueue(config, req)
+}
+
+// Enqueue validates config with the request's overrides applied and queues it
+func (q *BuildQueue) Enqueue(config Config, req BuildRequest) (Job, error) {
+	if err := req.apply(&config); err != nil {
+		return Job{}, err
+	}
+	platforms, err := selectedPlatforms(config.Platform, io.Discard)
+	if err != nil {
+		return Job{}, err
+	}
+	if len(platforms) == 0 {
+		return Job{}, errors.New("nothing to build: iOS builds require macOS")
+	}
+	workspace, err := filepath.Abs(config.RootPath)
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to resolve root path: %w", err)
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return Job{}, errors.New("build queue is shutting down")
+	}
+	job := &Job{
+		ID:          newRunID(),
+		Request:     req,
+		Workspace:   workspace,
+		Platforms:   platforms,
+		Version:     config.BuildVersion,
+		Status:      jobStatusQueued,
+		SubmittedAt: time.Now(),
+		config:      config,
+	}
+	q.jobs = append(q.jobs, job)
+	q.changedLocked()
+	snapshot := *job
+	q.mu.Unlock()
+	q.changed()
+	return snapshot, nil
+}
+
+// Jobs returns a snapshot of all known jobs in queue order
+func (q *BuildQueue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// Job returns a snapshot of one job
+func (q *BuildQueue) Job(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job := q.find(id); job != nil {
+		return *job, true
+	}
+	return Job{}, false
+}
+
+// RunActive reports whether runID belongs to a job that is still running
+func (q *BuildQueue) RunActive(runID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.ContainsFunc(q.jobs, func(j *Job) bool {
+		return j.RunID == runID && j.Status == jobStatusRunning
+	})
+}
+
+// Cancel drops a queued job or cancels the build of a running one
+func (q *BuildQueue) Cancel(id string) error {
+	q.mu.Lock()
+	job := q.find(id)
+	switch {
+	case job == nil:
+		q.mu.Unlock()
+		return fmt.Errorf("job %s not found", id)
+	case job.Status == jobStatusQueued:
+		job.Status = runStatusCancelled
+		job.FinishedAt = time.Now()
+		q.changedLocked()
+	case job.Status == jobStatusRunning:
+		job.cancelRequested = true
+		if job.run != nil {
+			job.run.Cancel()
+		}
+	default:
+		q.mu.Unlock()
+		return fmt.Errorf("job %s already finished (%s)", id, job.Status)
+	}
+	q.mu.Unlock()
+	q.changed()
+	return nil
+}
+
+// Move shifts a queued job by offset places among the queued jobs (negative = earlier)
+func (q *BuildQueue) Move(id string, offset int) error {
+	q.mu.Lock()
+	job := q.find(id)
+	if job == nil || job.Status != jobStatusQueued {
+		q.mu.Unlock()
+		return fmt.Errorf("job %s is not queued", id)
+	}
+	var queued []int // Indexes of queued jobs in q.jobs
+	for i, j := range q.jobs {
+		if j.Status == jobStatusQueued {
+			queued = append(queued, i)
+		}
+	}
+	from := slices.Index(queued, slices.Index(q.jobs, job))
+	to := min(max(from+offset, 0), len(queued)-1)
+	if from == to {
+		q.mu.Unlock()
+		return nil
+	}
+	// Rotate the job into its new slot; other queued jobs keep their relative order
+	step := 1
+	if to < from {
+		step = -1
+	}
+	for k := from; k != to; k += step {
+		a, b := queued[k], queued[k+step]
+		q.jobs[a], q.jobs[b] = q.jobs[b], q.jobs[a]
+	}
+	q.changedLocked()
+	q.mu.Unlock()
+	q.changed()
+	return nil
+}
+
+// ClearFinished forgets finished jobs; their runs stay in the log dir
+func (q *BuildQueue) ClearFinished() {
+	q.mu.Lock()
+	q.jobs = slices.DeleteFunc(q.jobs, (*Job).finished)
+	q.changedLocked()
+	q.mu.Unlock()
+	q.changed()
+}
+
+// Shutdown stops starting jobs, cancels running builds and waits for them to restore
+// their files. Queued jobs stay in the queue file for the next start.
+func (q *BuildQueue) Shutdown() {
+	q.mu.Lock()
+	q.closed = true
+	for _, job := range q.jobs {
+		if job.Status == jobStatusRunning {
+			job.cancelRequested = true
+			job.Interrupted = true
+			if job.run != nil {
+				job.run.Cancel()
+			}
+		}
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// dispatchLocked starts every queued job whose workspace and platform slots are free;
+// q.mu must be held
+func (q *BuildQueue) dispatchLocked() {
+	if q.closed || !q.started {
+		return
+	}
+	busy := make(map[string]bool)    // Workspaces with a running build
+	inUse := make(map[string]int)    // Running builds per platform
+	waiting := make(map[string]bool) // Workspaces and platforms an earlier queued job waits for
+	for _, job := range q.jobs {
+		if job.Status == jobStatusRunning {
+			busy[job.Workspace] = true
+			for _, p := range job.Platforms {
+				inUse[p]++
+			}
+		}
+	}
+	for _, job := range q.jobs {
+		if job.Status != jobStatusQueued {
+			continue
+		}
+		ready := !busy[job.Workspace] && !waiting[job.Workspace]
+		for _, p := range job.Platforms {
+			if inUse[p] >= q.limits.limit(p) || waiting[p] {
+				ready = false
+			}
+		}
+		if !ready {
+			waiting[job.Workspace] = true
+			for _, p := range job.Platforms {
+				waiting[p] = true
+			}
+			continue
+		}
+		busy[job.Workspace] = true
+		for _, p := range job.Platforms {
+			inUse[p]++
+		}
+		job.Status = jobStatusRunning
+		job.StartedAt = time.Now()
+		q.wg.Add(1)
+		go q.runJob(job)
+	}
+}
+
+// runJob creates the run for a job, executes it and records the outcome
+func (q *BuildQueue) runJob(job *Job) {
+	defer q.wg.Done()
+	run, err := NewBuildRun(job.config, q.sinks...)
+
+	q.mu.Lock()
+	if err != nil {
+		job.Status = runStatusFailed
+		job.Error = err.Error()
+		job.FinishedAt = time.Now()
+		q.changedLocked()
+		q.mu.Unlock()
+		q.changed()
+		q.finished(*job, err)
+		return
+	}
+	job.RunID = run.ID
+	job.run = run
+	if job.cancelRequested {
+		run.Cancel()
+	}
+	q.changedLocked()
+	q.mu.Unlock()
+	q.changed()
+
+	err = run.Execute()
+
+	q.mu.Lock()
+	job.Status = run.Manifest.Status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	job.FinishedAt = time.Now()
+	job.run = nil
+	q.pruneLocked()
+	q.changedLocked()
+	snapshot := *job
+	q.mu.Unlock()
+	q.changed()
+	q.finished(snapshot, err)
+}
+
+func (q *BuildQueue) finished(job Job, err error) {
+	if q.OnFinish != nil {
+		q.OnFinish(job, err)
+	}
+}
+
+func (q *BuildQueue) find(id string) *Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// pruneLocked forgets the oldest finished jobs beyond maxFinishedJobs
+func (q *BuildQueue) pruneLocked() {
+	finished := 0
+	for _, job := range q.jobs {
+		if job.finished() {
+			finished++
+		}
+	}
+	q.jobs = slices.DeleteFunc(q.jobs, func(j *Job) bool {
+		if finished > maxFinishedJobs && j.finished() {
+			finished--
+			return true
+		}
+		return false
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// QueuePanel lists the build queue with controls to reorder and cancel jobs.
+// Selecting a job shows its run in the log view.
+type QueuePanel struct {
+	queue *BuildQueue
+
+	jobs        []Job  // Snapshot shown in the list; only touched on the fyne thread
+	selected    string // Selected job ID
+	selectedRun string // Run of the selected job last passed to onSelect
+	notified    bool   // onSelect was called for the current selection
+
+	onSelect func(job Job)
+
+	list         *widget.List
+	upButton     *widget.Button
+	downButton   *widget.Button
+	cancelButton *widget.Button
+	clearButton  *widget.Button
+}
+
+// NewQueuePanel creates the panel; onSelect is called (on the fyne thread) when the
+// selected job changes or its run starts
+func NewQueuePanel(queue *BuildQueue, window fyne.Window, onSelect func(job Job)) *QueuePanel {
+	p := &QueuePanel{queue: queue, onSelect: onSelect}
+
+	p.list = widget.NewList(
+		func() int { return len(p.jobs) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			label := obj.(*widget.Label)
+			if id >= len(p.jobs) {
+				label.SetText("")
+				return
+			}
+			job := p.jobs[id]
+			switch job.Status {
+			case runStatusFailed:
+				label.Importance = widget.DangerImportance
+			case runStatusSucceeded:
+				label.Importance = widget.SuccessImportance
+			case jobStatusRunning:
+				label.Importance = widget.HighImportance
+			default:
+				label.Importance = widget.MediumImportance
+			}
+			label.SetText(jobLabel(job))
+		},
+	)
+	p.list.OnSelected = func(id widget.ListItemID) {
+		if id >= len(p.jobs) || p.jobs[id].ID == p.selected {
+			return // Selection moved with its job after a reorder
+		}
+		p.selected = p.jobs[id].ID
+		p.notified = false
+		p.update()
+	}
+
+	showErr := func(err error) {
+		if err != nil {
+			dialog.ShowError(err, window)
+		}
+	}
+	p.upButton = widget.NewButton("Up", func() { showErr(queue.Move(p.selected, -1)) })
+	p.downButton = widget.NewButton("Down", func() { showErr(queue.Move(p.selected, 1)) })
+	p.cancelButton = widget.NewButton("Cancel", func() { showErr(queue.Cancel(p.selected)) })
+	p.clearButton = widget.NewButton("Clear Finished", queue.ClearFinished)
+	p.update()
+	return p
+}
+
+// jobLabel is the one-line summary of a job in the list
+func jobLabel(job Job) string {
+	parts := []string{job.Status, strings.Join(job.Platforms, "+"), job.Version}
+	if job.Request.Profile != "" {
+		parts = append(parts, "["+job.Request.Profile+"]")
+	}
+	if job.Request.Ref != "" {
+		parts = append(parts, "@"+job.Request.Ref)
+	}
+	parts = append(parts, filepath.Base(job.Workspace), job.SubmittedAt.Format("15:04"))
+	return strings.Join(parts, "  ")
+}
+
+// Select makes jobID the selected job, e.g. right after it was queued
+func (p *QueuePanel) Select(jobID string) {
+	fyne.Do(func() {
+		p.selected = jobID
+		p.notified = false
+		p.update()
+	})
+}
+
+// Refresh reloads the jobs from the queue; safe to call from any goroutine
+func (p *QueuePanel) Refresh() {
+	jobs := p.queue.Jobs()
+	fyne.Do(func() {
+		p.jobs = jobs
+		p.update()
+	})
+}
+
+// update syncs the list selection and buttons with the selected job; fyne thread only
+func (p *QueuePanel) update() {
+	var job *Job
+	for i := range p.jobs {
+		if p.jobs[i].ID == p.selected {
+			job = &p.jobs[i]
+			p.list.Select(i) // No-op unless the job moved
+		}
+	}
+	if job == nil {
+		p.list.UnselectAll()
+	}
+	p.list.Refresh()
+
+	queued := job != nil && job.Status == jobStatusQueued
+	setEnabled(p.upButton, queued)
+	setEnabled(p.downButton, queued)
+	setEnabled(p.cancelButton, job != nil && !job.finished())
+
+	// Follow the selected job into its run once it starts
+	if job != nil && (!p.notified || job.RunID != p.selectedRun) {
+		p.notified = true
+		p.selectedRun = job.RunID
+		p.onSelect(*job)
+	}
+}
+
+func setEnabled(w fyne.Disableable, enabled bool) {
+	if enabled {
+		w.Enable()
+	} else {
+		w.Disable()
+	}
+}
+
+// Container returns the panel laid out for the main window
+func (p *QueuePanel) Container() fyne.CanvasObject {
+	buttons := container.NewHBox(p.upButton, p.downButton, p.cancelButton, p.clearButton)
+	title := widget.NewLabelWithStyle("Build Queue", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	return container.NewBorder(container.NewVBox(title, buttons), nil, nil, nil, p.list)
+}
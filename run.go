@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,33 +11,49 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
-func runCmd(logOutput io.Writer, printCmd bool, workDir string, command string, args ...string) error {
-	fmt.Fprintln(logOutput, "--- Running Command ---")
+const (
+	stderrTailLines = 20               // Number of trailing stderr lines kept on CommandError
+	stdoutTailLines = 200              // xcodebuild and altool report errors on stdout well before their last line
+	cancelWaitDelay = 10 * time.Second // How long a cancelled command gets to exit before its pipes are closed
+)
+
+// errBuildCancelled is returned when a run is cancelled by the user
+var errBuildCancelled = errors.New("build cancelled")
+
+// checkCancelled returns errBuildCancelled once the run behind logOutput has been cancelled
+func checkCancelled(logOutput io.Writer) error {
+	if logContext(logOutput).Err() != nil {
+		return errBuildCancelled
+	}
+	return nil
+}
 
-	var cmd *exec.Cmd
+// shellCommand wraps command and args in the user's login shell (PowerShell on Windows)
+// so tools installed via nvm, rbenv, Homebrew etc. are on PATH. The returned
+// description is suitable for logging. The command is killed, along with everything
+// the shell started, when the run behind logOutput is cancelled.
+func shellCommand(logOutput io.Writer, workDir string, command string, args ...string) (*exec.Cmd, string) {
 	var shell string
 	var shellArgs []string
+	var fullCmdStr string
 
 	if runtime.GOOS == "windows" {
 		shell = "powershell"                                              // or "cmd"
 		shellArgs = []string{"-NoProfile", "-NonInteractive", "-Command"} // PowerShell args
-		fullCmdStr := fmt.Sprintf("%s %s", command, strings.Join(args, " "))
-		cmd = exec.Command(shell, append(shellArgs, fullCmdStr)...)
-
-		if printCmd {
-			fmt.Fprintf(logOutput, "Shell: %s\nArgs: %s \"%s\"\nDirectory: %s\n", shell, strings.Join(shellArgs, " "), fullCmdStr, workDir)
-		}
-
+		fullCmdStr = fmt.Sprintf("%s %s", command, strings.Join(args, " "))
 	} else { // Unix-like
 		shell = os.Getenv("SHELL")
 		if shell == "" {
 			shell = "/bin/sh" // or "/bin/bash"
-			fmt.Fprintf(logOutput, "SHELL env var not set, defaulting to: %s\n", shell)
+			if logOutput != nil {
+				fmt.Fprintf(logOutput, "SHELL env var not set, defaulting to: %s\n", shell)
+			}
 		}
 		shellArgs = []string{"-l", "-c"}
-		fullCmdStr := command
+		fullCmdStr = command
 		if len(args) > 0 {
 			quotedArgs := make([]string, len(args))
 			for i, arg := range args {
@@ -47,29 +65,54 @@ func runCmd(logOutput io.Writer, printCmd bool, workDir string, command string,
 			}
 			fullCmdStr += " " + strings.Join(quotedArgs, " ")
 		}
-
-		cmd = exec.Command(shell, append(shellArgs, fullCmdStr)...)
-
-		if printCmd {
-			fmt.Fprintf(logOutput, "Shell: %s\nArgs: %s \"%s\"\nDirectory: %s\n", shell, strings.Join(shellArgs, " "), fullCmdStr, workDir)
-		}
 	}
 
+	cmd := exec.CommandContext(logContext(logOutput), shell, append(shellArgs, fullCmdStr)...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = cancelWaitDelay
 	if workDir != "" {
 		cmd.Dir = workDir
 	}
+	description := fmt.Sprintf("Shell: %s\nArgs: %s \"%s\"\nDirectory: %s\n", shell, strings.Join(shellArgs, " "), fullCmdStr, workDir)
+	return cmd, description
+}
+
+// runCmdOutput runs a command through the login shell and returns its trimmed stdout
+func runCmdOutput(workDir string, command string, args ...string) (string, error) {
+	cmd, _ := shellCommand(nil, workDir, command, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w - output: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func runCmd(logOutput io.Writer, printCmd bool, workDir string, command string, args ...string) error {
+	fmt.Fprintln(logOutput, "--- Running Command ---")
+
+	displayCmd := strings.TrimSpace(command + " " + strings.Join(args, " "))
+	cmd, description := shellCommand(logOutput, workDir, command, args...)
+	if printCmd {
+		fmt.Fprint(logOutput, description)
+	}
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
 		fmt.Fprintf(logOutput, "Error creating stdout pipe: %v\n", err)
-		return err
+		return &CommandError{Command: displayCmd, ExitCode: -1, Err: err}
 	}
 	stderrPipe, err := cmd.StderrPipe()
 	if err != nil {
 		fmt.Fprintf(logOutput, "Error creating stderr pipe: %v\n", err)
-		return err
+		return &CommandError{Command: displayCmd, ExitCode: -1, Err: err}
 	}
 
+	stderrTail := newLineTail(stderrTailLines)
+	stdoutTail := newLineTail(stdoutTailLines)
+	stdoutLog, stderrLog := commandStreams(logOutput)
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -77,7 +120,8 @@ func runCmd(logOutput io.Writer, printCmd bool, workDir string, command string,
 		defer wg.Done()
 		scanner := bufio.NewScanner(stdoutPipe)
 		for scanner.Scan() {
-			fmt.Fprintln(logOutput, scanner.Text())
+			stdoutTail.Add(scanner.Text())
+			fmt.Fprintln(stdoutLog, scanner.Text())
 		}
 		if err := scanner.Err(); err != nil {
 			fmt.Fprintf(logOutput, "Error reading stdout: %v\n", err)
@@ -88,21 +132,62 @@ func runCmd(logOutput io.Writer, printCmd bool, workDir string, command string,
 		defer wg.Done()
 		scanner := bufio.NewScanner(stderrPipe)
 		for scanner.Scan() {
-			fmt.Fprintln(logOutput, "ERR: "+scanner.Text())
+			stderrTail.Add(scanner.Text())
+			fmt.Fprintln(stderrLog, scanner.Text())
 		}
 		if err := scanner.Err(); err != nil {
 			fmt.Fprintf(logOutput, "Error reading stderr: %v\n", err)
 		}
 	}()
 
+	start := time.Now()
 	if err := cmd.Start(); err != nil {
 		fmt.Fprintf(logOutput, "Error starting command: %v\n", err)
-		return err
+		return &CommandError{Command: displayCmd, ExitCode: -1, Err: err}
 	}
 
 	wg.Wait()
 
 	err = cmd.Wait()
-	fmt.Fprintf(logOutput, "--- Command Finished (Exit Code: %d) ---\n", cmd.ProcessState.ExitCode())
-	return err
+	exitCode := cmd.ProcessState.ExitCode()
+	fmt.Fprintf(logOutput, "--- Command Finished (Exit Code: %d) ---\n", exitCode)
+	if err != nil {
+		return &CommandError{
+			Command:    displayCmd,
+			ExitCode:   exitCode,
+			Duration:   time.Since(start),
+			StderrTail: stderrTail.Lines(),
+			StdoutTail: stdoutTail.Lines(),
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// lineTail keeps the last N lines written to it (safe for concurrent use)
+type lineTail struct {
+	mu    sync.Mutex
+	max   int
+	lines []string
+}
+
+func newLineTail(max int) *lineTail {
+	return &lineTail{max: max, lines: make([]string, 0, max)}
+}
+
+// Add appends a line, dropping the oldest one once the limit is reached
+func (t *lineTail) Add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[1:]
+	}
+}
+
+// Lines returns a copy of the lines currently held
+func (t *lineTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
 }
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const scheduleCheckInterval = 30 * time.Second
+
+// ScheduleConfig is one entry of the schedules section
+type ScheduleConfig struct {
+	Name     string `yaml:"name"`     // Optional: shown in logs and history (default: the cron expression)
+	Cron     string `yaml:"cron"`     // minute hour day-of-month month day-of-week in local time, or @daily, @hourly, ...
+	Profile  string `yaml:"profile"`  // Optional: profile to build (default: the daemon's config)
+	Platform string `yaml:"platform"` // Optional: platform override
+	Branch   string `yaml:"branch"`   // Optional: branch to build; its head on the remote decides whether there is anything new
+	Remote   string `yaml:"remote"`   // Optional: remote the branch is read from (default origin)
+}
+
+// cronSchedule is a parsed five-field cron expression
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // Bit sets of the allowed values
+	domAny, dowAny                bool   // Day field started with *; when both are restricted either may match, as in cron
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+var (
+	cronMonthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	cronDayNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// parseCron parses "minute hour day-of-month month day-of-week". Fields take *, values,
+// ranges (1-5), steps (*/15, 0-30/10), lists (1,15) and JAN-DEC / SUN-SAT names.
+func parseCron(expr string) (cronSchedule, error) {
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("invalid cron expression '%s' (expected minute hour day-of-month month day-of-week)", expr)
+	}
+	specs := []struct {
+		lo, hi int
+		names  []string
+	}{{0, 59, nil}, {0, 23, nil}, {1, 31, nil}, {1, 12, cronMonthNames}, {0, 7, cronDayNames}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, specs[i].lo, specs[i].hi, specs[i].names)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid cron expression '%s': %w", expr, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // 7 is Sunday too
+	}
+	return cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		// As in Vixie cron, a day field starting with * (even */2) does not restrict the day
+		domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField returns the bit set of the values a field allows
+func parseCronField(field string, lo, hi int, names []string) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return lo + i, nil
+			}
+		}
+		return strconv.Atoi(s)
+	}
+
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+			step = n
+		}
+		start, end := lo, hi
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = value(from); err != nil {
+				return 0, fmt.Errorf("invalid value in '%s'", part)
+			}
+			end = start
+			if isRange {
+				if end, err = value(to); err != nil {
+					return 0, fmt.Errorf("invalid value in '%s'", part)
+				}
+			} else if hasStep {
+				end = hi // 5/15 means from 5 to the end in steps of 15
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("'%s' is outside %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t the schedule fires, or the zero time if it never does
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case c.month&(1<<int(m)) == 0:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// scheduledBuild is a schedule with the next time it fires
+type scheduledBuild struct {
+	ScheduleConfig
+	cron cronSchedule
+	next time.Time
+}
+
+// scheduler queues the builds of the schedules section when they are due, skipping
+// those with no new commits since their last successful scheduled build
+type scheduler struct {
+	schedules []*scheduledBuild
+	queue     *BuildQueue
+	resolve   func(BuildRequest) (Config, error)
+	logOutput io.Writer
+}
+
+// startScheduler runs the config's schedules until the returned stop function is called
+func startScheduler(config Config, queue *BuildQueue, resolve func(BuildRequest) (Config, error), logOutput io.Writer) (stop func(), err error) {
+	if len(config.Schedules) == 0 {
+		return func() {}, nil
+	}
+	s, err := newScheduler(config.Schedules, queue, resolve, logOutput)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+func newScheduler(configs []ScheduleConfig, queue *BuildQueue, resolve func(BuildRequest) (Config, error), logOutput io.Writer) (*scheduler, error) {
+	s := &scheduler{queue: queue, resolve: resolve, logOutput: logOutput}
+	now := time.Now()
+	names := make(map[string]bool)
+	for _, sc := range configs {
+		cron, err := parseCron(sc.Cron)
+		if err != nil {
+			return nil, err
+		}
+		if sc.Name == "" {
+			sc.Name = sc.Cron
+		}
+		if names[sc.Name] {
+			return nil, fmt.Errorf("duplicate schedule '%s': give each schedule a unique name", sc.Name)
+		}
+		names[sc.Name] = true
+		if sc.Remote == "" {
+			sc.Remote = defaultWatchRemote
+		}
+		sb := &scheduledBuild{ScheduleConfig: sc, cron: cron, next: cron.next(now)}
+		if sb.next.IsZero() {
+			return nil, fmt.Errorf("schedule '%s' never fires", sc.Name)
+		}
+		s.schedules = append(s.schedules, sb)
+	}
+	return s, nil
+}
+
+func (s *scheduler) run(ctx context.Context) {
+	for _, sb := range s.schedules {
+		fmt.Fprintf(s.logOutput, "Schedule %s: next build %s\n", sb.Name, sb.next.Format("Mon 2006-01-02 15:04"))
+	}
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.tick(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tick queues the schedules that are due. Runs missed while the daemon was down are not
+// made up for, as with cron.
+func (s *scheduler) tick(now time.Time) {
+	for _, sb := range s.schedules {
+		if now.Before(sb.next) {
+			continue
+		}
+		sb.next = sb.cron.next(now)
+		if err := s.fire(sb); err != nil {
+			fmt.Fprintf(s.logOutput, "Error: scheduled build %s: %v\n", sb.Name, err)
+		}
+	}
+}
+
+// fire queues a schedule's build unless the previous one is still queued or running, or
+// its commit was already built successfully by this schedule. Failed and interrupted
+// builds are retried the next time the schedule fires.
+func (s *scheduler) fire(sb *scheduledBuild) error {
+	req := BuildRequest{Profile: sb.Profile, Platform: sb.Platform, Branch: sb.Branch, Trigger: triggerSchedule + ":" + sb.Name}
+	if slices.ContainsFunc(s.queue.Jobs(), func(j Job) bool { return j.Request.Trigger == req.Trigger && !j.finished() }) {
+		fmt.Fprintf(s.logOutput, "Skipping scheduled build %s: the previous one has not finished; next %s\n",
+			sb.Name, sb.next.Format("Mon 15:04"))
+		return nil
+	}
+	config, err := s.resolve(req)
+	if err != nil {
+		return err
+	}
+	commit, err := scheduledCommit(config, sb.Branch, sb.Remote)
+	if err != nil {
+		return err
+	}
+	if commit == lastTriggeredCommit(config, req.Trigger) {
+		fmt.Fprintf(s.logOutput, "Skipping scheduled build %s: no new commits since the last one (%.7s); next %s\n",
+			sb.Name, commit, sb.next.Format("Mon 15:04"))
+		return nil
+	}
+	if sb.Branch != "" {
+		if err := fetchCommit(config.RootPath, sb.Remote, sb.Branch, commit); err != nil {
+			return err
+		}
+		req.Ref = commit // Build exactly the commit that was checked
+	}
+	job, err := s.queue.Enqueue(config, req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.logOutput, "Queued scheduled build %s at %.7s (job %s)\n", sb.Name, commit, job.ID)
+	return nil
+}
+
+// lastTriggeredCommit returns the commit of the newest successful run with trigger in
+// the config's log directory, or "" if there is none
+func lastTriggeredCommit(config Config, trigger string) string {
+	logDir, err := resolveLogDir(config)
+	if err != nil {
+		return ""
+	}
+	dirs, err := listRunDirs(logDir)
+	if err != nil {
+		return ""
+	}
+	for _, name := range dirs {
+		m, err := LoadRunManifest(filepath.Join(logDir, name))
+		if err == nil && m.Trigger == trigger && m.Status == runStatusSucceeded {
+			return m.Commit
+		}
+	}
+	return ""
+}
+
+// scheduledCommit returns the commit a scheduled build would build: the branch head on
+// the remote, or else the profile's ref (or checkout) in its root path
+func scheduledCommit(config Config, branch, remote string) (string, error) {
+	if branch != "" {
+		heads, err := remoteHeads(config.RootPath, remote, []string{branch})
+		if err != nil {
+			return "", err
+		}
+		if heads[branch] == "" {
+			return "", fmt.Errorf("branch %s not found on %s", branch, remote)
+		}
+		return heads[branch], nil
+	}
+	rev := "HEAD"
+	if config.Ref != "" {
+		rev = config.Ref
+	}
+	commit, err := gitOutput(config.RootPath, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the commit to build: %w", err)
+	}
+	return commit, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		name, expr, from, want string
+	}{
+		{"step from a value", "5/15 * * * *", "2024-05-01 10:00", "2024-05-01 10:05"},
+		{"step from a value wraps the hour", "5/15 * * * *", "2024-05-01 10:50", "2024-05-01 11:05"},
+		{"stepped range", "0-30/10 9 * * *", "2024-05-01 09:25", "2024-05-01 09:30"},
+		{"stepped range ends", "0-30/10 9 * * *", "2024-05-01 09:30", "2024-05-02 09:00"},
+		{"every 15 minutes", "*/15 * * * *", "2024-05-01 10:14", "2024-05-01 10:15"},
+		{"list", "0 8,17 * * *", "2024-05-01 08:00", "2024-05-01 17:00"},
+		{"month names", "0 8 1 JAN,jul *", "2024-02-10 00:00", "2024-07-01 08:00"},
+		{"day name range", "30 7 * * MON-FRI", "2024-05-03 08:00", "2024-05-06 07:30"},
+		{"lower-case day name", "0 9 * * sat", "2024-05-01 00:00", "2024-05-04 09:00"},
+		{"Sunday as 7", "0 12 * * 7", "2024-05-01 00:00", "2024-05-05 12:00"},
+		{"Sunday as 0", "0 12 * * 0", "2024-05-01 00:00", "2024-05-05 12:00"},
+		{"range up to 7", "0 12 * * 5-7", "2024-05-04 13:00", "2024-05-05 12:00"},
+		{"day of month or day of week", "0 0 13 * FRI", "2024-05-01 00:00", "2024-05-03 00:00"},
+		{"day of week or day of month", "0 0 13 * FRI", "2024-05-10 00:00", "2024-05-13 00:00"},
+		{"day of month only", "0 0 13 * *", "2024-05-01 00:00", "2024-05-13 00:00"},
+		{"day of week only", "0 0 * * FRI", "2024-05-01 00:00", "2024-05-03 00:00"},
+		{"stepped day of month and day of week", "0 0 */2 * FRI", "2024-05-04 00:00", "2024-05-17 00:00"},
+		{"day of month and stepped day of week", "0 0 13 * */2", "2024-05-01 00:00", "2024-06-13 00:00"},
+		{"month rollover", "0 0 31 * *", "2024-04-15 00:00", "2024-05-31 00:00"},
+		{"skips short months", "0 0 31 * *", "2024-05-31 00:00", "2024-07-31 00:00"},
+		{"day rollover at month end", "0 6 * * *", "2024-04-30 07:00", "2024-05-01 06:00"},
+		{"year rollover", "@yearly", "2024-06-01 00:00", "2025-01-01 00:00"},
+		{"leap day", "0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"@daily", "@daily", "2024-05-01 23:59", "2024-05-02 00:00"},
+		{"@daily at midnight", "@daily", "2024-05-02 00:00", "2024-05-03 00:00"},
+		{"@hourly", "@hourly", "2024-05-01 10:30", "2024-05-01 11:00"},
+		{"@weekly", "@weekly", "2024-05-01 00:00", "2024-05-05 00:00"},
+		{"@monthly", "@MONTHLY", "2024-05-01 00:00", "2024-06-01 00:00"},
+	}
+	for _, tt := range tests {
+		cron, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%s: parseCron(%q): %v", tt.name, tt.expr, err)
+			continue
+		}
+		if got := cron.next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%s: next(%q, %s) = %s, want %s", tt.name, tt.expr, tt.from, got.Format("Mon 2006-01-02 15:04"), tt.want)
+		}
+	}
+
+	never, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := never.next(at("2024-01-01 00:00")); !got.IsZero() {
+		t.Errorf("February 30th fires at %s", got)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",       // Too few fields
+		"* * * * * *",   // Too many
+		"60 * * * *",    // Minute out of range
+		"0 24 * * *",    // Hour out of range
+		"0 0 0 * *",     // Day of month starts at 1
+		"0 0 * 13 *",    // Month out of range
+		"0 0 * * 8",     // Day of week out of range
+		"*/0 * * * *",   // Zero step
+		"30-10 * * * *", // Backwards range
+		"0 0 * * FOO",   // Unknown name
+		"@fortnightly",  // Unknown macro
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) accepted an invalid expression", expr)
+		}
+	}
+}
+
+func TestSchedulerSkipsCommitsBuiltSuccessfully(t *testing.T) {
+	f := newWatchFixture(t)
+	resolve := func(BuildRequest) (Config, error) { return f.config, nil }
+	queue, err := NewBuildQueue(f.queuePath, QueueLimits{}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Shutdown()
+	var log strings.Builder
+	s, err := newScheduler([]ScheduleConfig{{Name: "nightly", Cron: "@daily", Branch: "main", Remote: f.remote}}, queue, resolve, &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := s.schedules[0]
+	fire := func(wantJobs int) []Job {
+		t.Helper()
+		if err := s.fire(sb); err != nil {
+			t.Fatal(err)
+		}
+		jobs := queue.Jobs()
+		if len(jobs) != wantJobs {
+			t.Fatalf("%d jobs after firing, want %d\n%s", len(jobs), wantJobs, log.String())
+		}
+		return jobs
+	}
+
+	sha := strings.TrimSpace(gitRun(t, f.dev, "rev-parse", "HEAD"))
+	jobs := fire(1)
+	if jobs[0].Request.Ref != sha || jobs[0].Request.Trigger != "schedule:nightly" {
+		t.Errorf("job request = %+v, want schedule:nightly at %s", jobs[0].Request, sha)
+	}
+	if _, err := gitOutput(f.root, "cat-file", "-e", sha+"^{commit}"); err != nil {
+		t.Errorf("commit was not fetched from the schedule's remote: %v", err)
+	}
+	fire(1) // Still queued
+
+	// The build fails (the checkout has no app), so the same commit is built again
+	queue.Start()
+	waitForJob(t, queue, jobs[0].ID)
+	jobs = fire(2)
+	waitForJob(t, queue, jobs[1].ID)
+
+	// A successful build of the commit is not repeated
+	m := &RunManifest{RunID: newRunID(), Status: runStatusSucceeded, Trigger: "schedule:nightly", Commit: sha}
+	if err := os.MkdirAll(filepath.Join(f.config.LogDir, m.RunID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Save(filepath.Join(f.config.LogDir, m.RunID)); err != nil {
+		t.Fatal(err)
+	}
+	fire(2)
+
+	// A new commit is
+	next := f.push(t, "feat: more")
+	jobs = fire(3)
+	if jobs[2].Request.Ref != next {
+		t.Errorf("third build is of %s, want %s", jobs[2].Request.Ref, next)
+	}
+}
+
+func TestLastTriggeredCommit(t *testing.T) {
+	logDir := t.TempDir()
+	config := Config{LogDir: logDir}
+	for _, m := range []RunManifest{
+		{RunID: "20240501-010000-000001", Status: runStatusSucceeded, Trigger: "schedule:nightly", Commit: "old"},
+		{RunID: "20240502-010000-000002", Status: runStatusSucceeded, Trigger: "schedule:nightly", Commit: "built"},
+		{RunID: "20240503-010000-000003", Status: runStatusFailed, Trigger: "schedule:nightly", Commit: "failed"},
+		{RunID: "20240504-010000-000004", Status: runStatusSucceeded, Trigger: "schedule:weekly", Commit: "other"},
+	} {
+		dir := filepath.Join(logDir, m.RunID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Save(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := lastTriggeredCommit(config, "schedule:nightly"); got != "built" {
+		t.Errorf("lastTriggeredCommit = %q, want the newest successful run's commit", got)
+	}
+	if got := lastTriggeredCommit(config, "schedule:hourly"); got != "" {
+		t.Errorf("lastTriggeredCommit without runs = %q", got)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Build number schemes (build_number_scheme)
+const (
+	buildNumberSchemePatch  = "patch"  // Build number is the patch version (default; no pre-releases)
+	buildNumberSchemeSemver = "semver" // Build number encodes major, minor, patch and pre-release
+)
+
+var semverRe = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z]+(?:\.[0-9A-Za-z]+)*))?$`)
+
+// preReleaseBands maps a pre-release label to the first build number slot it uses within
+// a patch version, so alpha < beta < rc < final release (slot 99)
+var preReleaseBands = map[string]int{"alpha": 0, "beta": 30, "rc": 60}
+
+const (
+	maxPreReleaseNumber = 29 // alpha.1..29, beta.1..29, rc.1..29 fit below the final-release slot
+	finalReleaseSlot    = 99
+)
+
+// SemVer is a parsed X.Y.Z[-pre] version
+type SemVer struct {
+	Major, Minor, Patch int
+	Pre                 string // Pre-release suffix without the dash, e.g. "rc.1"
+}
+
+// parseSemVer parses X.Y.Z with an optional pre-release suffix such as -rc.1
+func parseSemVer(version string) (SemVer, error) {
+	m := semverRe.FindStringSubmatch(version)
+	if m == nil {
+		return SemVer{}, fmt.Errorf("invalid version format (expected X.Y.Z or X.Y.Z-rc.N): %s", version)
+	}
+	var v SemVer
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	v.Pre = m[4]
+	return v, nil
+}
+
+func (v SemVer) String() string {
+	if v.Pre != "" {
+		return fmt.Sprintf("%d.%d.%d-%s", v.Major, v.Minor, v.Patch, v.Pre)
+	}
+	return v.Core()
+}
+
+// Core returns X.Y.Z without the pre-release suffix (what CFBundleShortVersionString accepts)
+func (v SemVer) Core() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Bump returns the next version for part (major, minor or patch). Like npm, bumping a
+// pre-release to the part it is a pre-release of just drops the suffix (1.3.0-rc.2 minor -> 1.3.0).
+func (v SemVer) Bump(part string) (SemVer, error) {
+	pre := v.Pre != ""
+	switch part {
+	case "major":
+		if !pre || v.Minor != 0 || v.Patch != 0 {
+			v.Major++
+		}
+		v.Minor, v.Patch = 0, 0
+	case "minor":
+		if !pre || v.Patch != 0 {
+			v.Minor++
+		}
+		v.Patch = 0
+	case "patch":
+		if !pre {
+			v.Patch++
+		}
+	default:
+		return v, fmt.Errorf("unknown version part '%s' (expected major, minor or patch)", part)
+	}
+	v.Pre = ""
+	return v, nil
+}
+
+// preReleaseSlot maps a pre-release suffix to 1..89 (alpha.N -> N, beta.N -> 30+N, rc.N -> 60+N)
+func preReleaseSlot(pre string) (int, error) {
+	label, numStr, _ := strings.Cut(pre, ".")
+	band, ok := preReleaseBands[label]
+	if !ok {
+		return 0, fmt.Errorf("unsupported pre-release '%s' (expected alpha.N, beta.N or rc.N)", pre)
+	}
+	n, err := strconv.Atoi(numStr)
+	if err != nil || n < 1 || n > maxPreReleaseNumber {
+		return 0, fmt.Errorf("pre-release number in '%s' must be between 1 and %d", pre, maxPreReleaseNumber)
+	}
+	return band + n, nil
+}
+
+// calculateBuildNumber derives the build number (versionCode / CFBundleVersion) from the version.
+// The semver scheme is major*1000000 + minor*10000 + patch*100 + slot, where slot is 99 for a
+// final release and 1..89 for pre-releases (see preReleaseSlot), so 1.2.3-rc.1 (1020361) sorts
+// before 1.2.3 (1020399) and after 1.2.2 (1020299).
+func calculateBuildNumber(version, scheme string) (int, error) {
+	v, err := parseSemVer(version)
+	if err != nil {
+		return 0, err
+	}
+	switch scheme {
+	case "", buildNumberSchemePatch:
+		if v.Pre != "" {
+			return 0, fmt.Errorf("pre-release version %s needs build_number_scheme: semver", version)
+		}
+		return calculateBuildNumberSimple(version)
+	case buildNumberSchemeSemver:
+		if v.Minor > 99 || v.Patch > 99 {
+			return 0, fmt.Errorf("minor and patch must be below 100 for the semver build number scheme: %s", version)
+		}
+		slot := finalReleaseSlot
+		if v.Pre != "" {
+			if slot, err = preReleaseSlot(v.Pre); err != nil {
+				return 0, err
+			}
+		}
+		return v.Major*1000000 + v.Minor*10000 + v.Patch*100 + slot, nil
+	default:
+		return 0, fmt.Errorf("unsupported build number scheme '%s' (expected patch or semver)", scheme)
+	}
+}
+
+// marketingVersion returns the version for CFBundleShortVersionString, which must be X.Y.Z
+func marketingVersion(version string) string {
+	if v, err := parseSemVer(version); err == nil {
+		return v.Core()
+	}
+	return version
+}
+
+var configBuildVersionRe = regexp.MustCompile(`(?m)^(build_version:[ \t]*)("[^"\n]*"|'[^'\n]*'|[^\s#]*)`)
+
+// updateConfigFileVersion sets build_version in a config file in place, keeping its comments
+func updateConfigFileVersion(configPath, version string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var updated []byte
+	if configBuildVersionRe.Match(data) {
+		updated = configBuildVersionRe.ReplaceAll(data, []byte(fmt.Sprintf(`${1}"%s"`, version)))
+	} else {
+		updated = append([]byte(fmt.Sprintf("build_version: \"%s\"\n", version)), data...)
+	}
+	if err := os.WriteFile(configPath, updated, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// bumpVersion bumps the current version and writes it to the configured version sources:
+// the config file's build_version (when configPath is set and the version comes from the
+// config) and app.json / package.json (when the version is read from or written to them).
+// With commit, the changed project files are committed. It returns the new version.
+func bumpVersion(config Config, configPath, part string, commit bool, logOutput io.Writer) (string, error) {
+	fromConfig := config.VersionSource == "" || config.VersionSource == versionSourceConfig
+	current := config.BuildVersion
+	if !fromConfig {
+		read, from, err := readVersionFromSource(config.RootPath, config.VersionSource)
+		if err != nil {
+			return "", fmt.Errorf("error reading version: %w", err)
+		}
+		fmt.Fprintf(logOutput, "Current version %s (from %s)\n", read, from)
+		current = read
+	}
+	v, err := parseSemVer(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := v.Bump(part)
+	if err != nil {
+		return "", err
+	}
+	version := next.String()
+	fmt.Fprintf(logOutput, "Bumping version %s -> %s\n", current, version)
+
+	if fromConfig && configPath != "" {
+		if err := updateConfigFileVersion(configPath, version); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(logOutput, "Set build_version in %s to %s\n", configPath, version)
+	}
+	if !fromConfig || config.WriteVersion {
+		if err := writeVersionToSources(config.RootPath, version, nil, logOutput); err != nil {
+			return "", err
+		}
+	}
+
+	if commit {
+		var paths []string
+		for _, name := range []string{"app.json", "package.json"} {
+			paths = append(paths, filepath.Join(config.RootPath, name))
+		}
+		if abs, err := filepath.Abs(configPath); err == nil && configPath != "" {
+			paths = append(paths, abs)
+		}
+		committed, err := gitCommitPaths(config.RootPath, "Bump version to "+version, paths)
+		if err != nil {
+			return "", err
+		}
+		if committed {
+			fmt.Fprintf(logOutput, "Committed version bump to %s\n", version)
+		} else {
+			fmt.Fprintln(logOutput, "No tracked version files changed; nothing to commit")
+		}
+	}
+	return version, nil
+}
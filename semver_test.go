@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSemVer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SemVer
+		wantErr bool
+	}{
+		{in: "1.2.3", want: SemVer{Major: 1, Minor: 2, Patch: 3}},
+		{in: "0.0.0", want: SemVer{}},
+		{in: "10.20.30-rc.1", want: SemVer{Major: 10, Minor: 20, Patch: 30, Pre: "rc.1"}},
+		{in: "1.0.0-beta", want: SemVer{Major: 1, Pre: "beta"}},
+		{in: "1.0.0-alpha.2.x", want: SemVer{Major: 1, Pre: "alpha.2.x"}},
+		{in: "1.2", wantErr: true},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "v1.2.3", wantErr: true},
+		{in: "1.2.3-", wantErr: true},
+		{in: "1.2.3-rc..1", wantErr: true},
+		{in: "1.2.3+build.5", wantErr: true},
+		{in: " 1.2.3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSemVer(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSemVer(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parseSemVer(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if err == nil && got.String() != tt.in {
+			t.Errorf("parseSemVer(%q).String() = %q", tt.in, got.String())
+		}
+	}
+}
+
+func TestSemVerBump(t *testing.T) {
+	tests := []struct {
+		version, part, want string
+	}{
+		{"1.2.3", "patch", "1.2.4"},
+		{"1.2.3", "minor", "1.3.0"},
+		{"1.2.3", "major", "2.0.0"},
+		{"1.2.3-rc.1", "patch", "1.2.3"},
+		{"1.3.0-rc.2", "minor", "1.3.0"},
+		{"1.3.1-rc.2", "minor", "1.4.0"},
+		{"2.0.0-beta.1", "major", "2.0.0"},
+		{"2.1.0-beta.1", "major", "3.0.0"},
+		{"2.0.1-beta.1", "major", "3.0.0"},
+		{"0.9.9", "major", "1.0.0"},
+	}
+	for _, tt := range tests {
+		v, err := parseSemVer(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := v.Bump(tt.part)
+		if err != nil {
+			t.Errorf("Bump(%s, %s): %v", tt.version, tt.part, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Bump(%s, %s) = %s, want %s", tt.version, tt.part, got, tt.want)
+		}
+	}
+	if _, err := (SemVer{Major: 1}).Bump("build"); err == nil {
+		t.Error("Bump accepted an unknown part")
+	}
+}
+
+func TestCalculateBuildNumber(t *testing.T) {
+	tests := []struct {
+		version, scheme string
+		want            int
+		wantErr         bool
+	}{
+		{version: "1.2.3", scheme: "", want: 3},
+		{version: "1.2.3", scheme: buildNumberSchemePatch, want: 3},
+		{version: "1.2.3-rc.1", scheme: buildNumberSchemePatch, wantErr: true},
+		{version: "1.2.3", scheme: buildNumberSchemeSemver, want: 1020399},
+		{version: "1.2.3-alpha.1", scheme: buildNumberSchemeSemver, want: 1020301},
+		{version: "1.2.3-alpha.29", scheme: buildNumberSchemeSemver, want: 1020329},
+		{version: "1.2.3-beta.1", scheme: buildNumberSchemeSemver, want: 1020331},
+		{version: "1.2.3-rc.1", scheme: buildNumberSchemeSemver, want: 1020361},
+		{version: "1.2.3-rc.29", scheme: buildNumberSchemeSemver, want: 1020389},
+		{version: "1.2.3-rc.0", scheme: buildNumberSchemeSemver, wantErr: true},
+		{version: "1.2.3-rc.30", scheme: buildNumberSchemeSemver, wantErr: true},
+		{version: "1.2.3-rc", scheme: buildNumberSchemeSemver, wantErr: true},
+		{version: "1.2.3-preview.1", scheme: buildNumberSchemeSemver, wantErr: true},
+		{version: "1.100.0", scheme: buildNumberSchemeSemver, wantErr: true},
+		{version: "1.2.100", scheme: buildNumberSchemeSemver, wantErr: true},
+		{version: "1.2.3", scheme: "date", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := calculateBuildNumber(tt.version, tt.scheme)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("calculateBuildNumber(%s, %q) error = %v, want error %v", tt.version, tt.scheme, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("calculateBuildNumber(%s, %q) = %d, want %d", tt.version, tt.scheme, got, tt.want)
+		}
+	}
+
+	// Each release's pre-releases sort after the previous release and before the release itself
+	order := []string{"1.2.2", "1.2.3-alpha.1", "1.2.3-alpha.29", "1.2.3-beta.1", "1.2.3-rc.1", "1.2.3-rc.29", "1.2.3", "1.2.4-alpha.1", "1.3.0", "2.0.0-rc.1"}
+	prev := 0
+	for _, version := range order {
+		n, err := calculateBuildNumber(version, buildNumberSchemeSemver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n <= prev {
+			t.Errorf("build number of %s (%d) does not sort after the previous version (%d)", version, n, prev)
+		}
+		prev = n
+	}
+}
+
+func TestMarketingVersion(t *testing.T) {
+	for in, want := range map[string]string{"1.2.3": "1.2.3", "1.2.3-rc.1": "1.2.3", "bogus": "bogus"} {
+		if got := marketingVersion(in); got != want {
+			t.Errorf("marketingVersion(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestUpdateConfigFileVersion(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"quoted", "root_path: \".\"\nbuild_version: \"1.2.3\" # Current release\n", "root_path: \".\"\nbuild_version: \"1.3.0\" # Current release\n"},
+		{"bare", "build_version: 1.2.3\nplatform: all\n", "build_version: \"1.3.0\"\nplatform: all\n"},
+		{"single quoted", "build_version: '1.2.3'\n", "build_version: \"1.3.0\"\n"},
+		{"missing", "platform: all\n", "build_version: \"1.3.0\"\nplatform: all\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rn-builder.yaml")
+			if err := os.WriteFile(path, []byte(tt.in), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := updateConfigFileVersion(path, "1.3.0"); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(path)
+			if string(got) != tt.want {
+				t.Errorf("config = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultServeAddr   = ":8787"
+	serveTokenEnv      = "RN_BUILDER_TOKEN" // Bearer token the API requires
+	defaultRunsLimit   = 50
+	logStreamInterval  = 500 * time.Millisecond
+	maxBuildRequestLen = 64 * 1024
+)
+
+var runIDRe = regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{6}$`)
+
+// apiServer serves the REST API of rn-builder serve
+type apiServer struct {
+	token  string
+	queue  *BuildQueue
+	logDir string
+}
+
+// runServeCommand starts the API server:
+// rn-builder serve [-config file] [-profiles dir] [-addr host:port] [-tls-cert file -tls-key file]
+func runServeCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfig, "Config file used when a build names no profile")
+	profilesDir := fs.String("profiles", "", "Directory with <profile>.yaml config files (default: the config file's directory)")
+	addr := fs.String("addr", defaultServeAddr, "Address to listen on")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file (serve HTTPS)")
+	tlsKey := fs.String("tls-key", "", "TLS key file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	token := os.Getenv(serveTokenEnv)
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "Error: set %s to the token API clients must send\n", serveTokenEnv)
+		return 1
+	}
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	logDir, err := resolveLogDir(*config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	statePath, err := queueStatePath("serve")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	profiles := newProfileLoader(*configPath, *profilesDir, logDir)
+	s := &apiServer{token: token, logDir: logDir}
+	if s.queue, err = NewBuildQueue(statePath, config.Queue, profiles.load, &textSink{w: os.Stdout}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	logger := NewRunLogger("", &textSink{w: os.Stdout})
+	logger.SetStep("schedule")
+	stopSchedules, err := startScheduler(*config, s.queue, profiles.load, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	s.queue.Start()
+	server := s.httpServer(*addr)
+
+	// Ctrl+C stops the server and cancels builds, which still restore the files they edited
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+	go func() {
+		if _, ok := <-interrupts; ok {
+			fmt.Fprintln(os.Stderr, "Shutting down, cancelling running builds (queued ones are kept)...")
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(ctx)
+		}
+	}()
+
+	fmt.Printf("Serving the build API on %s (runs in %s)\n", *addr, logDir)
+	if *tlsCert != "" {
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	stopSchedules()
+	s.queue.Shutdown()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// httpServer returns the server for the API. Shutdown waits for handlers to return, so it
+// also cancels the request contexts; log streams would otherwise run until their build ends.
+func (s *apiServer) httpServer(addr string) *http.Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        addr,
+		Handler:     s.routes(),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	server.RegisterOnShutdown(cancel)
+	return server
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/builds", s.handleSubmit)
+	mux.HandleFunc("GET /api/jobs", s.handleJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleJob)
+	mux.HandleFunc("DELETE /api/jobs/{id}", s.handleCancelJob)
+	mux.HandleFunc("POST /api/jobs/{id}/move", s.handleMoveJob)
+	mux.HandleFunc("GET /api/runs", s.handleRuns)
+	mux.HandleFunc("GET /api/runs/{id}", s.handleRun)
+	mux.HandleFunc("GET /api/runs/{id}/log", s.handleRunLog)
+	mux.HandleFunc("GET /api/runs/{id}/log/stream", s.handleRunLogStream)
+	mux.HandleFunc("GET /api/runs/{id}/artifacts/{name}", s.handleArtifact)
+	return s.authenticate(mux)
+}
+
+// authenticate requires "Authorization: Bearer <token>", or ?token= for clients such as
+// EventSource that cannot set headers
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// POST /api/builds with a BuildRequest body queues a build
+func (s *apiServer) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req BuildRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBuildRequestLen))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid build request: %w", err))
+		return
+	}
+	req.Trigger = triggerAPI
+	job, err := s.queue.Submit(req)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *apiServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.queue.Jobs())
+}
+
+func (s *apiServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.Job(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// DELETE /api/jobs/{id} removes a queued job or cancels a running build
+func (s *apiServer) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.queue.Cancel(id); err != nil {
+		status := http.StatusConflict
+		if _, ok := s.queue.Job(id); !ok {
+			status = http.StatusNotFound
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	job, _ := s.queue.Job(id)
+	writeJSON(w, http.StatusOK, job)
+}
+
+// POST /api/jobs/{id}/move with {"offset": n} moves a queued job n places (negative = earlier)
+func (s *apiServer) handleMoveJob(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Offset int `json:"offset"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBuildRequestLen)).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid move request: %w", err))
+		return
+	}
+	id := r.PathValue("id")
+	if err := s.queue.Move(id, body.Offset); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	job, _ := s.queue.Job(id)
+	writeJSON(w, http.StatusOK, job)
+}
+
+// GET /api/runs?limit=N lists run manifests, newest first
+func (s *apiServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRunsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid limit '%s'", value))
+			return
+		}
+		limit = n
+	}
+	dirs, err := listRunDirs(s.logDir)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	runs := []*RunManifest{}
+	for _, name := range dirs[:min(limit, len(dirs))] {
+		if m, err := LoadRunManifest(filepath.Join(s.logDir, name)); err == nil {
+			runs = append(runs, m)
+		}
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// runDir returns the folder of the run named in the request path, or writes a 404
+func (s *apiServer) runDir(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	dir := filepath.Join(s.logDir, id)
+	if runIDRe.MatchString(id) {
+		if _, err := os.Stat(filepath.Join(dir, runManifestFile)); err == nil {
+			return dir, true
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, fmt.Errorf("run %s not found", id))
+	return "", false
+}
+
+func (s *apiServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.runDir(w, r)
+	if !ok {
+		return
+	}
+	m, err := LoadRunManifest(dir)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// GET /api/runs/{id}/log returns the log written so far as plain text
+func (s *apiServer) handleRunLog(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.runDir(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, r, filepath.Join(dir, runLogFile))
+}
+
+// GET /api/runs/{id}/log/stream sends the log as server-sent events: one "data" event per
+// line, following the file while the run is active, then an "end" event with the status
+func (s *apiServer) handleRunLogStream(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.runDir(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	file, err := os.Open(filepath.Join(dir, runLogFile))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("failed to open log: %w", err))
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	id := r.PathValue("id")
+	reader := bufio.NewReader(file)
+	partial := ""
+	for {
+		// Checked before reading so lines written just before the run ended are not missed
+		done := !s.queue.RunActive(id)
+		for {
+			line, err := reader.ReadString('\n')
+			partial += line
+			if err != nil {
+				break // EOF; keep the incomplete line for the next pass
+			}
+			fmt.Fprintf(w, "data: %s\n\n", strings.TrimRight(partial, "\r\n"))
+			partial = ""
+		}
+		if done {
+			status := ""
+			if m, err := LoadRunManifest(dir); err == nil {
+				status = m.Status
+			}
+			fmt.Fprintf(w, "event: end\ndata: %s\n\n", status)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(logStreamInterval):
+		}
+	}
+}
+
+// GET /api/runs/{id}/artifacts/{name} downloads an artifact listed in the run manifest
+func (s *apiServer) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.runDir(w, r)
+	if !ok {
+		return
+	}
+	m, err := LoadRunManifest(dir)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	name := r.PathValue("name")
+	i := slices.IndexFunc(m.Artifacts, func(path string) bool { return filepath.Base(path) == name })
+	if i < 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("artifact %s not found in run %s", name, m.RunID))
+		return
+	}
+	if !filepath.IsAbs(m.Artifacts[i]) {
+		// Runs from before artifacts were kept in the run folder point into a shared dist/
+		writeAPIError(w, http.StatusGone, fmt.Errorf("artifact %s of run %s was not kept with the run", name, m.RunID))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, m.Artifacts[i])
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeepArtifactMovesIntoRunFolder(t *testing.T) {
+	dist := t.TempDir()
+	runDir := t.TempDir()
+	apk := filepath.Join(dist, "app-1.0.0-7-release.apk")
+	if err := os.WriteFile(apk, []byte("apk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := keepArtifact(apk, runDir, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(runDir, "app-1.0.0-7-release.apk"); kept != want {
+		t.Errorf("kept = %s, want %s", kept, want)
+	}
+	if _, err := os.Stat(apk); !os.IsNotExist(err) {
+		t.Errorf("artifact left in dist/: %v", err)
+	}
+}
+
+func TestHandleArtifact(t *testing.T) {
+	logDir := t.TempDir()
+	const runID = "20240501-101500-abcdef"
+	runDir := filepath.Join(logDir, runID)
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	apk := filepath.Join(runDir, "app-1.0.0-7-release.apk")
+	if err := os.WriteFile(apk, []byte("this run's apk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := &RunManifest{RunID: runID, Status: runStatusSucceeded, Artifacts: []string{apk, "dist/ios/App-1.0.0-7.ipa"}}
+	if err := m.Save(runDir); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer((&apiServer{token: "secret", logDir: logDir}).routes())
+	defer server.Close()
+
+	get := func(name string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/runs/"+runID+"/artifacts/"+name, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if status, body := get("app-1.0.0-7-release.apk"); status != http.StatusOK || body != "this run's apk" {
+		t.Errorf("kept artifact: %d %q", status, body)
+	}
+	if status, _ := get("App-1.0.0-7.ipa"); status != http.StatusGone {
+		t.Errorf("artifact with a shared relative path: status %d, want %d", status, http.StatusGone)
+	}
+	if status, _ := get("other.apk"); status != http.StatusNotFound {
+		t.Errorf("unknown artifact: status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+// newTestAPI serves an API whose queue is never started, so submitted jobs stay queued
+func newTestAPI(t *testing.T) (*apiServer, *httptest.Server) {
+	t.Helper()
+	root := t.TempDir()
+	resolve := func(req BuildRequest) (Config, error) {
+		return Config{RootPath: root, Platform: "android", BuildVersion: "1.0.0"}, nil
+	}
+	queue, err := NewBuildQueue(filepath.Join(t.TempDir(), queueStateFile), QueueLimits{}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &apiServer{token: "secret", queue: queue, logDir: t.TempDir()}
+	server := httptest.NewServer(s.routes())
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+// apiCall sends an authenticated request and decodes a JSON response into out (if not nil)
+func apiCall(t *testing.T, server *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	_, server := newTestAPI(t)
+	tests := []struct {
+		name, header, query string
+		want                int
+	}{
+		{"bearer token", "Bearer secret", "", http.StatusOK},
+		{"query token", "", "secret", http.StatusOK},
+		{"query token with another scheme", "Basic dXNlcjpwdw==", "secret", http.StatusOK},
+		{"wrong bearer token", "Bearer wrong", "", http.StatusUnauthorized},
+		{"wrong query token", "", "wrong", http.StatusUnauthorized},
+		{"wrong bearer beats right query token", "Bearer wrong", "secret", http.StatusUnauthorized},
+		{"token prefix", "Bearer secre", "", http.StatusUnauthorized},
+		{"no token", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := server.URL + "/api/jobs"
+			if tt.query != "" {
+				url += "?token=" + tt.query
+			}
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Error("401 without WWW-Authenticate: Bearer")
+			}
+		})
+	}
+}
+
+func TestAPISubmitCancelMove(t *testing.T) {
+	_, server := newTestAPI(t)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		var job Job
+		// Clients cannot claim another trigger
+		if status := apiCall(t, server, http.MethodPost, "/api/builds", `{"platform":"android","trigger":"watch"}`, &job); status != http.StatusAccepted {
+			t.Fatalf("submit: status %d", status)
+		}
+		if job.Status != jobStatusQueued || job.Request.Trigger != triggerAPI {
+			t.Fatalf("submitted job = %+v", job)
+		}
+		ids = append(ids, job.ID)
+	}
+	for _, body := range []string{`{"platform":"windows"}`, `{"platfrom":"android"}`, `{`} {
+		if status := apiCall(t, server, http.MethodPost, "/api/builds", body, nil); status != http.StatusBadRequest {
+			t.Errorf("submit %s: status %d, want 400", body, status)
+		}
+	}
+
+	order := func() []string {
+		var jobs []Job
+		apiCall(t, server, http.MethodGet, "/api/jobs", "", &jobs)
+		var out []string
+		for _, job := range jobs {
+			if job.Status == jobStatusQueued {
+				out = append(out, job.ID)
+			}
+		}
+		return out
+	}
+	if status := apiCall(t, server, http.MethodPost, "/api/jobs/"+ids[2]+"/move", `{"offset":-2}`, nil); status != http.StatusOK {
+		t.Fatalf("move: status %d", status)
+	}
+	if got := order(); strings.Join(got, ",") != strings.Join([]string{ids[2], ids[0], ids[1]}, ",") {
+		t.Errorf("queue after move = %v", got)
+	}
+	if status := apiCall(t, server, http.MethodPost, "/api/jobs/missing/move", `{"offset":1}`, nil); status != http.StatusConflict {
+		t.Errorf("move unknown job: status %d, want 409", status)
+	}
+
+	var cancelled Job
+	if status := apiCall(t, server, http.MethodDelete, "/api/jobs/"+ids[0], "", &cancelled); status != http.StatusOK || cancelled.Status != runStatusCancelled {
+		t.Errorf("cancel: status %d, job %+v", status, cancelled)
+	}
+	if got := order(); strings.Join(got, ",") != strings.Join([]string{ids[2], ids[1]}, ",") {
+		t.Errorf("queue after cancel = %v", got)
+	}
+	if status := apiCall(t, server, http.MethodDelete, "/api/jobs/"+ids[0], "", nil); status != http.StatusConflict {
+		t.Errorf("cancel a finished job: status %d, want 409", status)
+	}
+	if status := apiCall(t, server, http.MethodDelete, "/api/jobs/missing", "", nil); status != http.StatusNotFound {
+		t.Errorf("cancel unknown job: status %d, want 404", status)
+	}
+	if status := apiCall(t, server, http.MethodPost, "/api/jobs/"+ids[0]+"/move", `{"offset":1}`, nil); status != http.StatusConflict {
+		t.Errorf("move a cancelled job: status %d, want 409", status)
+	}
+}
+
+// addRunningRun creates a run folder with a log and a running job for it
+func addRunningRun(t *testing.T, s *apiServer, runID, log string) (logPath string, finish func()) {
+	t.Helper()
+	dir := filepath.Join(s.logDir, runID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&RunManifest{RunID: runID, Status: runStatusRunning}).Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	logPath = filepath.Join(dir, runLogFile)
+	if err := os.WriteFile(logPath, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{ID: runID, RunID: runID, Status: jobStatusRunning}
+	s.queue.mu.Lock()
+	s.queue.jobs = append(s.queue.jobs, job)
+	s.queue.mu.Unlock()
+	return logPath, func() {
+		if err := (&RunManifest{RunID: runID, Status: runStatusSucceeded}).Save(dir); err != nil {
+			t.Error(err)
+		}
+		s.queue.mu.Lock()
+		job.Status = runStatusSucceeded
+		s.queue.mu.Unlock()
+	}
+}
+
+// openLogStream starts an SSE request and returns a reader over its lines
+func openLogStream(t *testing.T, url string) (*bufio.Scanner, func()) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		resp.Body.Close()
+		t.Fatalf("stream: status %d, content type %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewScanner(resp.Body), func() { resp.Body.Close() }
+}
+
+// nextEvent reads one server-sent event and returns its lines
+func nextEvent(t *testing.T, scanner *bufio.Scanner) []string {
+	t.Helper()
+	var lines []string
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			return lines
+		}
+		lines = append(lines, scanner.Text())
+	}
+	t.Fatalf("stream ended after %q: %v", lines, scanner.Err())
+	return nil
+}
+
+func TestAPILogStream(t *testing.T) {
+	s, server := newTestAPI(t)
+	const runID = "20240501-101500-abcdef"
+	logPath, finish := addRunningRun(t, s, runID, "first line\nsecond ")
+
+	scanner, closeStream := openLogStream(t, server.URL+"/api/runs/"+runID+"/log/stream?token=secret")
+	defer closeStream()
+	if got := nextEvent(t, scanner); strings.Join(got, "|") != "data: first line" {
+		t.Fatalf("first event = %q", got)
+	}
+
+	// The incomplete line is sent once the build finishes it
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("line\nthird line\n")
+	f.Close()
+	if got := nextEvent(t, scanner); strings.Join(got, "|") != "data: second line" {
+		t.Fatalf("second event = %q", got)
+	}
+	if got := nextEvent(t, scanner); strings.Join(got, "|") != "data: third line" {
+		t.Fatalf("third event = %q", got)
+	}
+
+	finish()
+	if got := nextEvent(t, scanner); strings.Join(got, "|") != "event: end|data: "+runStatusSucceeded {
+		t.Fatalf("end event = %q", got)
+	}
+
+	if status := apiCall(t, server, http.MethodGet, "/api/runs/20240501-101500-000000/log/stream", "", nil); status != http.StatusNotFound {
+		t.Errorf("stream of an unknown run: status %d, want 404", status)
+	}
+}
+
+func TestAPIShutdownEndsLogStreams(t *testing.T) {
+	s, _ := newTestAPI(t)
+	const runID = "20240501-101500-abcdef"
+	addRunningRun(t, s, runID, "building\n")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := s.httpServer("")
+	go server.Serve(listener)
+
+	scanner, closeStream := openLogStream(t, "http://"+listener.Addr().String()+"/api/runs/"+runID+"/log/stream?token=secret")
+	defer closeStream()
+	nextEvent(t, scanner)
+
+	// The run is still going; shutdown must not wait for it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	for scanner.Scan() {
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	stepRefreshInterval = 500 * time.Millisecond // Keeps the running step's elapsed time current
+	maxStepRuns         = 20                     // Runs whose steps are kept for the step view
+)
+
+// stepLabels are the display names of the build steps
+var stepLabels = map[string]string{
+	"worktree":  "Worktree",
+	"git":       "Working tree check",
+	"setup":     "Version",
+	"branch":    "Branch detection",
+	"changelog": "Release notes",
+	"env":       "Environment update",
+	"deps":      "Dependencies",
+	"prebuild":  "Prebuild",
+	"android":   "Android",
+	"gradle":    "Gradle build",
+	"ios":       "iOS",
+	"pods":      "CocoaPods",
+	"archive":   "Archive",
+	"export":    "Export",
+	"upload":    "Upload",
+	"tag":       "Release tag",
+	"restore":   "Restore files",
+	"cleanup":   "Worktree cleanup",
+}
+
+// stepState is one step of a run as shown in the step view
+type stepState struct {
+	Platform string
+	Step     string
+	Status   string
+	Started  time.Time
+	Ended    time.Time
+	Done     int64
+	Total    int64
+}
+
+func (s stepState) label() string {
+	label := stepLabels[s.Step]
+	if label == "" {
+		label = s.Step
+	}
+	if s.Platform != "" && s.Platform != s.Step {
+		label = s.Platform + ": " + label // e.g. android: Upload
+	}
+	if s.Status == runStatusRunning && s.Total > 0 {
+		label += fmt.Sprintf(" %d%%", s.Done*100/s.Total)
+	}
+	return label
+}
+
+func (s stepState) elapsed(now time.Time) string {
+	end := s.Ended
+	if s.Status == runStatusRunning {
+		end = now
+	}
+	return end.Sub(s.Started).Round(time.Second).String()
+}
+
+func stepIcon(status string) fyne.Resource {
+	switch status {
+	case runStatusSucceeded:
+		return theme.ConfirmIcon()
+	case runStatusFailed:
+		return theme.ErrorIcon()
+	case runStatusCancelled:
+		return theme.CancelIcon()
+	}
+	return theme.MediaPlayIcon()
+}
+
+// StepView lists the steps of the selected run with their state and elapsed time, and
+// the percentage of uploads. It follows step events; log lines are ignored.
+type StepView struct {
+	mu    sync.Mutex
+	runs  map[string][]*stepState // Run ID -> steps in the order they started
+	order []string                // Run IDs, oldest first
+	runID string                  // Run shown
+	dirty bool
+
+	visible []stepState // Steps currently shown; only touched on the fyne thread
+
+	list *widget.List
+}
+
+// NewStepView creates the step view and starts its refresh loop
+func NewStepView() *StepView {
+	sv := &StepView{runs: make(map[string][]*stepState)}
+	sv.list = widget.NewList(
+		func() int { return len(sv.visible) },
+		func() fyne.CanvasObject {
+			bar := widget.NewProgressBar()
+			bar.Hide()
+			return container.NewBorder(nil, bar, widget.NewIcon(theme.MediaPlayIcon()), widget.NewLabel(""), widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			row := obj.(*fyne.Container)
+			// NewBorder stores the center first, then bottom, left and right
+			name := row.Objects[0].(*widget.Label)
+			bar := row.Objects[1].(*widget.ProgressBar)
+			icon := row.Objects[2].(*widget.Icon)
+			elapsed := row.Objects[3].(*widget.Label)
+			if id >= len(sv.visible) {
+				name.SetText("")
+				elapsed.SetText("")
+				bar.Hide()
+				return
+			}
+			step := sv.visible[id]
+			icon.SetResource(stepIcon(step.Status))
+			name.SetText(step.label())
+			elapsed.SetText(step.elapsed(time.Now()))
+			if step.Status == runStatusRunning && step.Total > 0 {
+				bar.SetValue(float64(step.Done) / float64(step.Total))
+				bar.Show()
+			} else {
+				bar.Hide()
+			}
+		},
+	)
+	go sv.refreshLoop()
+	return sv
+}
+
+// WriteRecord ignores log lines; StepView only needs step events
+func (sv *StepView) WriteRecord(rec LogRecord) {}
+
+// WriteStep records a step starting, progressing or ending
+func (sv *StepView) WriteStep(e StepEvent) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	steps := sv.runs[e.RunID]
+	var current *stepState
+	for i := len(steps) - 1; i >= 0; i-- {
+		if s := steps[i]; s.Platform == e.Platform && s.Step == e.Step && s.Status == runStatusRunning {
+			current = s
+			break
+		}
+	}
+	switch {
+	case current == nil && e.Status == runStatusRunning:
+		if len(steps) == 0 {
+			sv.addRunLocked(e.RunID)
+		}
+		steps = append(steps, &stepState{Platform: e.Platform, Step: e.Step, Status: e.Status, Started: e.Time, Done: e.Done, Total: e.Total})
+	case current == nil:
+		return // End of a step that started before the view existed
+	case e.Status == runStatusRunning:
+		current.Done, current.Total = e.Done, e.Total
+	default:
+		current.Status = e.Status
+		current.Ended = e.Time
+	}
+	sv.runs[e.RunID] = steps
+	sv.dirty = sv.dirty || e.RunID == sv.runID
+}
+
+// addRunLocked starts tracking a run, forgetting the oldest beyond maxStepRuns
+func (sv *StepView) addRunLocked(runID string) {
+	sv.order = append(sv.order, runID)
+	if len(sv.order) > maxStepRuns {
+		delete(sv.runs, sv.order[0])
+		sv.order = sv.order[1:]
+	}
+}
+
+// SetRun shows the steps of one run (empty shows none)
+func (sv *StepView) SetRun(runID string) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.runID = runID
+	sv.dirty = true
+}
+
+// refreshLoop pushes changes to the list, and ticks the elapsed time of running steps
+func (sv *StepView) refreshLoop() {
+	ticker := time.NewTicker(stepRefreshInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sv.mu.Lock()
+		snapshot := make([]stepState, 0, len(sv.runs[sv.runID]))
+		running := false
+		for _, s := range sv.runs[sv.runID] {
+			snapshot = append(snapshot, *s)
+			running = running || s.Status == runStatusRunning
+		}
+		refresh := sv.dirty || running
+		sv.dirty = false
+		sv.mu.Unlock()
+		if !refresh {
+			continue
+		}
+
+		fyne.Do(func() {
+			sv.visible = snapshot
+			sv.list.Refresh()
+		})
+	}
+}
+
+// Container returns the step list with a title, laid out for the main window
+func (sv *StepView) Container() fyne.CanvasObject {
+	title := widget.NewLabelWithStyle("Build Steps", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	return container.NewBorder(title, nil, nil, nil, sv.list)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ascBaseURL          = "https://api.appstoreconnect.apple.com"
+	ascDefaultLocale    = "en-US"
+	ascBuildWaitTimeout = 20 * time.Minute // How long to wait for an uploaded build to show up
+	ascBuildPollDelay   = 30 * time.Second
+)
+
+// AppStoreConnectConfig is the App Store Connect API key used to set TestFlight's
+// What to Test after an upload (altool cannot set it)
+type AppStoreConnectConfig struct {
+	KeyID    string `yaml:"key_id"`    // API key ID (Users and Access > Integrations)
+	IssuerID string `yaml:"issuer_id"` // Issuer ID shown above the key list
+	KeyPath  string `yaml:"key_path"`  // The AuthKey_<key_id>.p8 file downloaded for the key
+	AppID    string `yaml:"app_id"`    // The app's Apple ID (App Information > Apple ID)
+	Locale   string `yaml:"locale"`    // What to Test locale (default en-US)
+}
+
+// configured reports whether enough is set to call the API
+func (c AppStoreConnectConfig) configured() bool {
+	return c.KeyID != "" && c.IssuerID != "" && c.KeyPath != "" && c.AppID != ""
+}
+
+// ascClient calls the App Store Connect API with a signed key token
+type ascClient struct {
+	baseURL   string
+	token     string
+	http      *http.Client
+	pollDelay time.Duration
+}
+
+func newASCClient(config AppStoreConnectConfig) (*ascClient, error) {
+	token, err := ascToken(config, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &ascClient{baseURL: ascBaseURL, token: token, http: &http.Client{Timeout: 30 * time.Second}, pollDelay: ascBuildPollDelay}, nil
+}
+
+// ascToken signs the ES256 JWT App Store Connect expects; tokens may live up to 20 minutes
+func ascToken(config AppStoreConnectConfig, now time.Time) (string, error) {
+	data, err := os.ReadFile(config.KeyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read App Store Connect key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("App Store Connect key %s is not a PEM file", config.KeyPath)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse App Store Connect key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("App Store Connect key %s is not an EC key", config.KeyPath)
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": config.KeyID, "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss": config.IssuerID,
+		"iat": now.Unix(),
+		"exp": now.Add(19 * time.Minute).Unix(),
+		"aud": "appstoreconnect-v1",
+	})
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign App Store Connect token: %w", err)
+	}
+	// JWS wants the raw 32-byte r and s, not ASN.1
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
+
+// ascResource is the part of a JSON:API resource the client reads
+type ascResource struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Locale string `json:"locale"`
+	} `json:"attributes"`
+}
+
+// do sends a JSON:API request and decodes the "data" member of the response into out
+func (c *ascClient) do(ctx context.Context, method, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("App Store Connect request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("App Store Connect returned status %d for %s %s: %s", resp.StatusCode, method, path, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("invalid App Store Connect response: %w", err)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// findBuild waits for the uploaded build to appear; App Store Connect lists it a few
+// minutes after altool returns
+func (c *ascClient) findBuild(ctx context.Context, appID, version string, buildNumber int, logOutput io.Writer) (string, error) {
+	query := url.Values{
+		"filter[app]":                       {appID},
+		"filter[version]":                   {strconv.Itoa(buildNumber)},
+		"filter[preReleaseVersion.version]": {version},
+		"limit":                             {"1"},
+	}
+	deadline := time.Now().Add(ascBuildWaitTimeout)
+	for {
+		var builds []ascResource
+		if err := c.do(ctx, http.MethodGet, "/v1/builds?"+query.Encode(), nil, &builds); err != nil {
+			return "", err
+		}
+		if len(builds) > 0 {
+			return builds[0].ID, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("build %s (%d) did not appear in App Store Connect within %s", version, buildNumber, ascBuildWaitTimeout)
+		}
+		fmt.Fprintf(logOutput, "Waiting for App Store Connect to list build %s (%d)...\n", version, buildNumber)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(c.pollDelay):
+		}
+	}
+}
+
+// setWhatsNew sets the build's What to Test text for locale, creating the localization
+// if the build has none for it yet
+func (c *ascClient) setWhatsNew(ctx context.Context, buildID, locale, text string) error {
+	var localizations []ascResource
+	if err := c.do(ctx, http.MethodGet, "/v1/builds/"+url.PathEscape(buildID)+"/betaBuildLocalizations", nil, &localizations); err != nil {
+		return err
+	}
+	for _, l := range localizations {
+		if l.Attributes.Locale == locale {
+			body := map[string]any{"data": map[string]any{
+				"type":       "betaBuildLocalizations",
+				"id":         l.ID,
+				"attributes": map[string]string{"whatsNew": text},
+			}}
+			return c.do(ctx, http.MethodPatch, "/v1/betaBuildLocalizations/"+url.PathEscape(l.ID), body, nil)
+		}
+	}
+	body := map[string]any{"data": map[string]any{
+		"type":       "betaBuildLocalizations",
+		"attributes": map[string]string{"locale": locale, "whatsNew": text},
+		"relationships": map[string]any{
+			"build": map[string]any{"data": map[string]string{"type": "builds", "id": buildID}},
+		},
+	}}
+	return c.do(ctx, http.MethodPost, "/v1/betaBuildLocalizations", body, nil)
+}
+
+// setTestFlightWhatToTest sets What to Test on the build just uploaded from the release notes
+func setTestFlightWhatToTest(config Config, buildNumber int, notes *ReleaseNotes, logOutput io.Writer) error {
+	asc := config.AppStoreConnect
+	if !asc.configured() {
+		return errors.New("app_store_connect key_id, issuer_id, key_path and app_id are needed to set What to Test")
+	}
+	client, err := newASCClient(asc)
+	if err != nil {
+		return err
+	}
+	return client.setWhatToTest(logContext(logOutput), asc, marketingVersion(config.BuildVersion), buildNumber, whatToTestText(notes), logOutput)
+}
+
+func (c *ascClient) setWhatToTest(ctx context.Context, asc AppStoreConnectConfig, version string, buildNumber int, text string, logOutput io.Writer) error {
+	locale := asc.Locale
+	if locale == "" {
+		locale = ascDefaultLocale
+	}
+	buildID, err := c.findBuild(ctx, asc.AppID, version, buildNumber, logOutput)
+	if err != nil {
+		return err
+	}
+	if err := c.setWhatsNew(ctx, buildID, locale, text); err != nil {
+		return err
+	}
+	fmt.Fprintf(logOutput, "Set TestFlight What to Test (%s) for build %s (%d)\n", locale, version, buildNumber)
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestASCTokenSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "AuthKey_KEY123.p8")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	token, err := ascToken(AppStoreConnectConfig{KeyID: "KEY123", IssuerID: "issuer", KeyPath: keyPath}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token has %d parts", len(parts))
+	}
+	enc := base64.RawURLEncoding
+	var header map[string]string
+	var claims map[string]any
+	for i, v := range []any{&header, &claims} {
+		data, err := enc.DecodeString(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if header["alg"] != "ES256" || header["kid"] != "KEY123" {
+		t.Errorf("header = %v", header)
+	}
+	if claims["iss"] != "issuer" || claims["aud"] != "appstoreconnect-v1" || claims["iat"] != float64(now.Unix()) {
+		t.Errorf("claims = %v", claims)
+	}
+	if exp := claims["exp"].(float64); exp-float64(now.Unix()) > 20*60 {
+		t.Errorf("token lives %vs, App Store Connect allows 20 minutes", exp-float64(now.Unix()))
+	}
+
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		t.Fatalf("signature is %d bytes (%v), want 64", len(sig), err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Error("signature does not verify")
+	}
+
+	if _, err := ascToken(AppStoreConnectConfig{KeyPath: filepath.Join(t.TempDir(), "missing.p8")}, now); err == nil {
+		t.Error("missing key file accepted")
+	}
+}
+
+// ascStandIn serves the App Store Connect endpoints setWhatToTest uses. The build is
+// listed from the second query on, like a build that is still being ingested.
+type ascStandIn struct {
+	mu            sync.Mutex
+	buildQueries  int
+	localizations string // JSON array returned for the build's localizations
+	requests      []string
+	bodies        []string
+}
+
+func (a *ascStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	a.requests = append(a.requests, r.Method+" "+r.URL.Path)
+	a.bodies = append(a.bodies, string(body))
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/builds":
+		q := r.URL.Query()
+		if q.Get("filter[app]") != "123" || q.Get("filter[version]") != "10203" || q.Get("filter[preReleaseVersion.version]") != "1.2.3" {
+			http.Error(w, "unexpected filter "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		a.buildQueries++
+		if a.buildQueries == 1 {
+			io.WriteString(w, `{"data":[]}`)
+			return
+		}
+		io.WriteString(w, `{"data":[{"type":"builds","id":"build-1"}]}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/builds/build-1/betaBuildLocalizations":
+		io.WriteString(w, `{"data":`+a.localizations+`}`)
+	case r.Method == http.MethodPatch && r.URL.Path == "/v1/betaBuildLocalizations/loc-en":
+		io.WriteString(w, `{"data":{}}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/betaBuildLocalizations":
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"data":{}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSetWhatToTest(t *testing.T) {
+	cases := []struct {
+		name          string
+		localizations string
+		wantLast      string
+		wantBody      string
+	}{
+		{
+			name:          "updates the existing localization",
+			localizations: `[{"type":"betaBuildLocalizations","id":"loc-de","attributes":{"locale":"de-DE"}},{"type":"betaBuildLocalizations","id":"loc-en","attributes":{"locale":"en-US"}}]`,
+			wantLast:      "PATCH /v1/betaBuildLocalizations/loc-en",
+			wantBody:      `{"data":{"attributes":{"whatsNew":"Fixed login"},"id":"loc-en","type":"betaBuildLocalizations"}}`,
+		},
+		{
+			name:          "creates a missing localization",
+			localizations: `[{"type":"betaBuildLocalizations","id":"loc-de","attributes":{"locale":"de-DE"}}]`,
+			wantLast:      "POST /v1/betaBuildLocalizations",
+			wantBody:      `{"data":{"attributes":{"locale":"en-US","whatsNew":"Fixed login"},"relationships":{"build":{"data":{"id":"build-1","type":"builds"}}},"type":"betaBuildLocalizations"}}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			standIn := &ascStandIn{localizations: tc.localizations}
+			server := httptest.NewServer(standIn)
+			defer server.Close()
+
+			client := &ascClient{baseURL: server.URL, token: "token", http: server.Client(), pollDelay: time.Millisecond}
+			asc := AppStoreConnectConfig{AppID: "123"}
+			if err := client.setWhatToTest(context.Background(), asc, "1.2.3", 10203, "Fixed login", io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			standIn.mu.Lock()
+			defer standIn.mu.Unlock()
+			if standIn.buildQueries != 2 {
+				t.Errorf("queried builds %d times, want 2 (waiting for the build to appear)", standIn.buildQueries)
+			}
+			last := len(standIn.requests) - 1
+			if standIn.requests[last] != tc.wantLast {
+				t.Errorf("last request = %s, want %s", standIn.requests[last], tc.wantLast)
+			}
+			if standIn.bodies[last] != tc.wantBody {
+				t.Errorf("body = %s\nwant %s", standIn.bodies[last], tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestSetWhatToTestReportsAPIErrors(t *testing.T) {
+	server := httptest.NewServer(&ascStandIn{})
+	defer server.Close()
+	client := &ascClient{baseURL: server.URL, token: "wrong", http: server.Client(), pollDelay: time.Millisecond}
+	err := client.setWhatToTest(context.Background(), AppStoreConnectConfig{AppID: "123"}, "1.2.3", 10203, "notes", io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("err = %v, want the 401 reported", err)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+)
+
+// Tray icon states
+const (
+	trayIdle     = "idle"
+	trayBuilding = "building"
+	trayFailed   = "failed" // The most recent build failed
+)
+
+// trayRefreshInterval is how often the Quick Build menu picks up added or removed profiles
+const trayRefreshInterval = 30 * time.Second
+
+// TrayIcon shows the build state in the system tray, with a menu to bring the window
+// back, to queue a build of any profile and to quit. Closing the window hides it.
+type TrayIcon struct {
+	desk   desktop.App
+	app    fyne.App
+	window fyne.Window
+	queue  *BuildQueue
+	loader profileLoader
+
+	mu       sync.Mutex
+	state    string
+	summary  string
+	profiles []string // Profile names in the Quick Build menu
+
+	done     chan struct{} // Closed by quit to stop the refresh loop
+	stopOnce sync.Once
+}
+
+// NewTrayIcon adds the tray icon, or returns nil where the app has no system tray.
+// All methods are no-ops on a nil TrayIcon.
+func NewTrayIcon(a fyne.App, window fyne.Window, queue *BuildQueue, profiles profileLoader) *TrayIcon {
+	desk, ok := a.(desktop.App)
+	if !ok {
+		return nil
+	}
+	t := &TrayIcon{desk: desk, app: a, window: window, queue: queue, loader: profiles, done: make(chan struct{})}
+	window.SetCloseIntercept(window.Hide) // Builds keep running; Quit is in the tray menu
+	t.Refresh()
+	go t.refreshLoop()
+	return t
+}
+
+// refreshLoop refreshes the tray every trayRefreshInterval until quit
+func (t *TrayIcon) refreshLoop() {
+	ticker := time.NewTicker(trayRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.Refresh()
+		}
+	}
+}
+
+// Refresh updates the icon and menu from the queue and the profiles on disk; safe to
+// call from any goroutine
+func (t *TrayIcon) Refresh() {
+	if t == nil {
+		return
+	}
+	state, summary := trayState(t.queue.Jobs())
+	profiles := t.loader.list()
+	t.mu.Lock()
+	changed := state != t.state || summary != t.summary || !slices.Equal(profiles, t.profiles)
+	t.state, t.summary, t.profiles = state, summary, profiles
+	t.mu.Unlock()
+	if !changed {
+		return
+	}
+	fyne.Do(func() {
+		t.desk.SetSystemTrayIcon(trayStateIcon(state))
+		t.desk.SetSystemTrayMenu(t.menu(summary, profiles))
+	})
+}
+
+// trayState summarizes the queue: building while any job is unfinished, otherwise
+// failed if the most recently finished build failed
+func trayState(jobs []Job) (state, summary string) {
+	var active []Job
+	var last *Job
+	for i, job := range jobs {
+		if !job.finished() {
+			active = append(active, job)
+		} else if last == nil || job.FinishedAt.After(last.FinishedAt) {
+			last = &jobs[i]
+		}
+	}
+	switch {
+	case len(active) == 1:
+		return trayBuilding, "Building " + jobTitle(active[0])
+	case len(active) > 1:
+		return trayBuilding, fmt.Sprintf("Building (%d jobs)", len(active))
+	case last != nil && last.Status == runStatusFailed:
+		return trayFailed, "Last build failed: " + jobTitle(*last)
+	}
+	return trayIdle, "Idle"
+}
+
+func trayStateIcon(state string) fyne.Resource {
+	switch state {
+	case trayBuilding:
+		return theme.ViewRefreshIcon()
+	case trayFailed:
+		return theme.ErrorIcon()
+	}
+	return theme.ComputerIcon()
+}
+
+// menu builds the tray menu
+func (t *TrayIcon) menu(summary string, profiles []string) *fyne.Menu {
+	status := fyne.NewMenuItem(summary, nil)
+	status.Disabled = true
+	show := fyne.NewMenuItem("Show rn-builder", func() {
+		t.window.Show()
+		t.window.RequestFocus()
+	})
+
+	builds := []*fyne.MenuItem{fyne.NewMenuItem("Default ("+defaultConfig+")", func() { t.quickBuild("") })}
+	for _, name := range profiles {
+		builds = append(builds, fyne.NewMenuItem(name, func() { t.quickBuild(name) }))
+	}
+	quickBuild := fyne.NewMenuItem("Quick Build", nil)
+	quickBuild.ChildMenu = fyne.NewMenu("", builds...)
+
+	quit := fyne.NewMenuItem("Quit", t.quit)
+	quit.IsQuit = true // Replaces the driver's Quit, which would skip the shutdown
+
+	return fyne.NewMenu("rn-builder", status, fyne.NewMenuItemSeparator(), show, quickBuild, fyne.NewMenuItemSeparator(), quit)
+}
+
+// quit cancels running builds, waiting for them to restore their files, then quits.
+// The wait happens off the UI thread, which the builds' log output still needs.
+func (t *TrayIcon) quit() {
+	t.stopOnce.Do(func() { close(t.done) })
+	if slices.ContainsFunc(t.queue.Jobs(), func(j Job) bool { return j.Status == jobStatusRunning }) {
+		t.app.SendNotification(fyne.NewNotification("Quitting rn-builder", "Cancelling running builds; queued ones are kept"))
+	}
+	go func() {
+		t.queue.Shutdown()
+		fyne.Do(t.app.Quit)
+	}()
+}
+
+// quickBuild queues a profile as saved on disk; the window may be hidden, so problems
+// are reported as a desktop notification
+func (t *TrayIcon) quickBuild(profile string) {
+	job, err := t.queue.Submit(BuildRequest{Profile: profile, Trigger: triggerManual})
+	if err != nil {
+		t.app.SendNotification(fyne.NewNotification("Build not queued", err.Error()))
+		return
+	}
+	t.app.SendNotification(fyne.NewNotification("Build queued", jobTitle(job)))
+}
+
+// jobTitle names a job in notifications and the tray menu, e.g. "android+ios 1.2.3 [staging]"
+func jobTitle(job Job) string {
+	title := strings.Join(job.Platforms, "+") + " " + job.Version
+	if job.Request.Profile != "" {
+		title += " [" + job.Request.Profile + "]"
+	}
+	return title
+}
+
+// sendBuildNotification tells the desktop a build finished, since builds take long
+// enough for the window to be forgotten
+func sendBuildNotification(a fyne.App, job Job, err error) {
+	var title, content string
+	switch job.Status {
+	case runStatusSucceeded:
+		title, content = "Build succeeded", jobTitle(job)
+	case runStatusCancelled:
+		title, content = "Build cancelled", jobTitle(job)
+	default:
+		title = "Build failed"
+		content = jobTitle(job)
+		if err != nil {
+			reason, _, _ := strings.Cut(err.Error(), "\n")
+			content += ": " + reason
+		}
+	}
+	notification := fyne.NewNotification(title, content)
+	fyne.Do(func() { a.SendNotification(notification) })
+}
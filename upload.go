@@ -12,15 +12,40 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"golang.org/x/oauth2"
 )
 
 type GoogleDriveFile struct {
-	Name     string   `json:"name"`
-	MimeType string   `json:"mimeType"`
-	Parents  []string `json:"parents,omitempty"`
+	Name        string   `json:"name"`
+	MimeType    string   `json:"mimeType"`
+	Parents     []string `json:"parents,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// progressReader counts the bytes read through it and reports the percentage as the
+// step's progress, logging every 10%
+type progressReader struct {
+	r         io.Reader
+	total     int64
+	done      int64
+	percent   int64 // Last percentage reported
+	logOutput io.Writer
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.total > 0 {
+		if percent := p.done * 100 / p.total; percent != p.percent {
+			if percent/10 != p.percent/10 {
+				fmt.Fprintf(p.logOutput, "Uploaded %d%% (%d of %d bytes)\n", percent, p.done, p.total)
+			}
+			p.percent = percent
+			logProgress(p.logOutput, p.done, p.total)
+		}
+	}
+	return n, err
 }
 
 func uploadToTestFlightGUI(config Config, isMainBranch bool, ipaPath string, logOutput io.Writer) error {
@@ -81,23 +106,21 @@ func uploadToTestFlightGUI(config Config, isMainBranch bool, ipaPath string, log
 
 	fmt.Fprintln(logOutput, "Starting upload command (this might take a while)...")
 	if err := runCmd(logOutput, false, "", altoolCmd, uploadArgs...); err != nil {
-		// Provide more helpful error message for common auth issues
-		if strings.Contains(err.Error(), "Authentication failed") || strings.Contains(err.Error(), "status 401") {
-			return fmt.Errorf("TestFlight upload authentication failed. Check Apple ID, password/keychain item (%s), and potentially 2FA requirements: %w", passwordArg, err)
-		}
-		return fmt.Errorf("TestFlight upload command failed: %w", err)
+		// Map common altool failures (auth, duplicate build, missing app record) to helpful messages
+		return classifyAltoolError(err, passwordArg)
 	}
 
 	fmt.Fprintln(logOutput, "IPA uploaded to TestFlight/App Store Connect successfully (processing may continue on Apple's side)")
 	return nil
 }
 
-func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.Writer) error {
+// uploadToGoogleDriveWithAPIGUI uploads the APK into the configured Drive folder and returns a link to it
+func uploadToGoogleDriveWithAPIGUI(config Config, apkPath, description string, logOutput io.Writer) (string, error) {
 	fmt.Fprintln(logOutput, "Uploading APK to Google Drive using API...")
 
 	// Check if APK exists
 	if _, err := os.Stat(apkPath); os.IsNotExist(err) {
-		return fmt.Errorf("APK file not found for upload: %s", apkPath)
+		return "", fmt.Errorf("APK file not found for upload: %s", apkPath)
 	}
 
 	// Validate credentials path early
@@ -105,17 +128,17 @@ func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.W
 	if credentialsPath == "" {
 		credentialsPath = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
 		if credentialsPath == "" {
-			return errors.New("google credentials path not specified in config (google_credentials) or GOOGLE_APPLICATION_CREDENTIALS environment variable")
+			return "", errors.New("google credentials path not specified in config (google_credentials) or GOOGLE_APPLICATION_CREDENTIALS environment variable")
 		}
 	}
 	if _, err := os.Stat(credentialsPath); os.IsNotExist(err) {
-		return fmt.Errorf("google credentials file not found at: %s", credentialsPath)
+		return "", fmt.Errorf("google credentials file not found at: %s", credentialsPath)
 	}
 
 	// Get OAuth2 token source
 	tokenSource, err := getGoogleTokenSource(credentialsPath)
 	if err != nil {
-		return fmt.Errorf("failed to get Google token source: %w", err)
+		return "", fmt.Errorf("failed to get Google token source: %w", err)
 	}
 
 	// Create HTTP client with OAuth2
@@ -124,13 +147,13 @@ func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.W
 	// Open the file
 	file, err := os.Open(apkPath)
 	if err != nil {
-		return fmt.Errorf("failed to open APK file '%s': %w", apkPath, err)
+		return "", fmt.Errorf("failed to open APK file '%s': %w", apkPath, err)
 	}
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to get file info for '%s': %w", apkPath, err)
+		return "", fmt.Errorf("failed to get file info for '%s': %w", apkPath, err)
 	}
 	fileSize := fileInfo.Size()
 	fmt.Fprintf(logOutput, "Uploading file: %s (%d bytes)\n", filepath.Base(apkPath), fileSize)
@@ -153,9 +176,10 @@ func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.W
 
 		// Create metadata part
 		metadata := GoogleDriveFile{
-			Name:     filepath.Base(apkPath), // Use the actual filename
-			MimeType: "application/vnd.android.package-archive",
-			Parents:  []string{config.DriveFolderID},
+			Name:        filepath.Base(apkPath), // Use the actual filename
+			MimeType:    "application/vnd.android.package-archive",
+			Parents:     []string{config.DriveFolderID},
+			Description: description, // Release notes, shown in Drive's file details
 		}
 
 		metadataJSON, err := json.Marshal(metadata)
@@ -192,7 +216,7 @@ func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.W
 
 		// Copy file data with progress indication
 		fmt.Fprintln(logOutput, "Starting file data copy to upload stream...")
-		copiedBytes, err := io.Copy(part, file)
+		copiedBytes, err := io.Copy(part, &progressReader{r: file, total: fileSize, logOutput: logOutput})
 		if err != nil {
 			writeErr = fmt.Errorf("failed to copy file data to upload stream: %w", err)
 			pw.CloseWithError(writeErr)
@@ -205,7 +229,7 @@ func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.W
 	// Create the request
 	req, err := http.NewRequestWithContext(context.Background(), "POST", googleDriveUploadURL, pr)
 	if err != nil {
-		return fmt.Errorf("failed to create upload request: %w", err)
+		return "", fmt.Errorf("failed to create upload request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.ContentLength = -1 // Let the client handle streaming length or chunking
@@ -217,10 +241,10 @@ func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.W
 		// Check error from the goroutine writing the pipe *before* blaming the client.Do call
 		writerErr := <-uploadErrChan
 		if writerErr != nil {
-			return fmt.Errorf("error occurred during upload data preparation: %w", writerErr)
+			return "", fmt.Errorf("error occurred during upload data preparation: %w", writerErr)
 		}
 		// If no writer error, then the network request itself failed
-		return fmt.Errorf("failed to execute Google Drive upload request: %w", err)
+		return "", fmt.Errorf("failed to execute Google Drive upload request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -231,16 +255,24 @@ func uploadToGoogleDriveWithAPIGUI(config Config, apkPath string, logOutput io.W
 		fmt.Fprintf(logOutput, "Warning: Google Drive API returned OK, but data writing encountered an error: %v\n", writerErr)
 	} else if writerErr != nil {
 		// If writer failed and response code is also error, report writer error primarily
-		return fmt.Errorf("error occurred during upload data preparation: %w", writerErr)
+		return "", fmt.Errorf("error occurred during upload data preparation: %w", writerErr)
 	}
 
 	// Check response status
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("google Drive upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return "", fmt.Errorf("google Drive upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	fmt.Fprintln(logOutput, "Google Drive API request successful.")
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	link := ""
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err == nil && uploaded.ID != "" {
+		link = fmt.Sprintf(googleDriveFileViewURL, uploaded.ID)
+		fmt.Fprintf(logOutput, "Drive link: %s\n", link)
+	}
 	fmt.Fprintln(logOutput, "APK uploaded to Google Drive successfully.")
-	return nil
+	return link, nil
 }
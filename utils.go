@@ -4,10 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -15,9 +15,9 @@ import (
 	"golang.org/x/oauth2/google"
 )
 
-func isValidVersion(version string) bool { // Keep as is
-	matched, _ := regexp.MatchString(`^\d+\.\d+\.\d+$`, version)
-	return matched
+func isValidVersion(version string) bool {
+	_, err := parseSemVer(version) // X.Y.Z with an optional pre-release suffix (-rc.1)
+	return err == nil
 }
 
 func calculateBuildNumberSimple(version string) (int, error) { // Keep as is
@@ -48,6 +48,111 @@ func getCurrentGitBranch(rootPath string) (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
+func getCurrentGitCommit(rootPath string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = rootPath
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get git commit: %w - output: %s", err, string(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// moveFile renames src to dst, copying across filesystems (a worktree under the
+// user data dir may be on a different volume than the output directory)
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// gitCommitPaths commits whichever of paths (inside rootPath) have changes, reporting whether a commit was made
+func gitCommitPaths(rootPath, message string, paths []string) (bool, error) {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve root path: %w", err)
+	}
+	var changed []string
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absRoot, absPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue // Not part of the project repository
+		}
+		cmd := exec.Command("git", "status", "--porcelain", "--", rel)
+		cmd.Dir = rootPath
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return false, fmt.Errorf("failed to get git status: %w - output: %s", err, string(output))
+		}
+		if strings.TrimSpace(string(output)) != "" {
+			changed = append(changed, rel)
+		}
+	}
+	if len(changed) == 0 {
+		return false, nil
+	}
+
+	for _, args := range [][]string{
+		append([]string{"add", "--"}, changed...),
+		append([]string{"commit", "-m", message, "--"}, changed...),
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = rootPath
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return false, fmt.Errorf("git %s failed: %w - output: %s", args[0], err, string(output))
+		}
+	}
+	return true, nil
+}
+
+// createReleaseTag creates an annotated v<version> tag on HEAD. An existing tag on the
+// same commit is left alone; one on another commit is an error (tags are never moved).
+func createReleaseTag(rootPath, version string) (tag string, created bool, err error) {
+	tag = "v" + version
+	head, err := getCurrentGitCommit(rootPath)
+	if err != nil {
+		return tag, false, err
+	}
+	cmd := exec.Command("git", "rev-list", "-n", "1", "refs/tags/"+tag)
+	cmd.Dir = rootPath
+	if output, err := cmd.Output(); err == nil {
+		if strings.TrimSpace(string(output)) == head {
+			return tag, false, nil
+		}
+		return tag, false, fmt.Errorf("tag %s already exists on a different commit", tag)
+	}
+
+	cmd = exec.Command("git", "tag", "-a", tag, "-m", "Release "+version)
+	cmd.Dir = rootPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return tag, false, fmt.Errorf("failed to create tag %s: %w - output: %s", tag, err, string(output))
+	}
+	return tag, true, nil
+}
+
 func findIOSWorkspaceAndScheme(config *Config) (workspace string, scheme string, err error) {
 	iosDir := filepath.Join(config.RootPath, "ios")
 
@@ -73,7 +178,7 @@ func findIOSWorkspaceAndScheme(config *Config) (workspace string, scheme string,
 			return "", "", fmt.Errorf("failed to read ios directory %s: %w", iosDir, readErr)
 		}
 		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(file.Name(), ".xcworkspace") {
+			if strings.HasSuffix(file.Name(), ".xcworkspace") { // Bundles are directories
 				workspace = filepath.Join(iosDir, file.Name())
 				break // Take the first one found
 			}
@@ -81,7 +186,7 @@ func findIOSWorkspaceAndScheme(config *Config) (workspace string, scheme string,
 		if workspace == "" {
 			// If no workspace, look for project file
 			for _, file := range files {
-				if !file.IsDir() && strings.HasSuffix(file.Name(), ".xcodeproj") {
+				if strings.HasSuffix(file.Name(), ".xcodeproj") {
 					workspace = filepath.Join(iosDir, file.Name())
 					fmt.Printf("Warning: No .xcworkspace found, using project '%s'\n", workspace)
 					break
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Where the build version comes from (version_source)
+const (
+	versionSourceConfig      = "config"       // build_version / the GUI field (default)
+	versionSourceAuto        = "auto"         // First of app.config, app.json, package.json that declares one
+	versionSourceAppJSON     = "app.json"     // expo.version in app.json
+	versionSourceAppConfig   = "app.config"   // Evaluated Expo config (npx expo config --json)
+	versionSourcePackageJSON = "package.json" // version in package.json
+)
+
+// versionSources lists the version_source values, for validation and the GUI
+var versionSources = []string{versionSourceConfig, versionSourceAuto, versionSourceAppJSON, versionSourceAppConfig, versionSourcePackageJSON}
+
+var jsonVersionFieldRe = regexp.MustCompile(`("version"\s*:\s*)"[^"]*"`)
+var jsonExpoKeyRe = regexp.MustCompile(`"expo"\s*:\s*\{`)
+
+// readAppJSONVersion returns expo.version from app.json ("" if not set)
+func readAppJSONVersion(rootPath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(rootPath, "app.json"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read app.json: %w", err)
+	}
+	var appJSON struct {
+		Expo struct {
+			Version string `json:"version"`
+		} `json:"expo"`
+	}
+	if err := json.Unmarshal(data, &appJSON); err != nil {
+		return "", fmt.Errorf("failed to parse app.json: %w", err)
+	}
+	return appJSON.Expo.Version, nil
+}
+
+// readExpoConfigVersion evaluates the Expo config (including app.config.js/ts) with the Expo CLI
+func readExpoConfigVersion(rootPath string) (string, error) {
+	output, err := runCmdOutput(rootPath, "npx", "expo", "config", "--json")
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate Expo config: %w", err)
+	}
+	var expoConfig struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(output), &expoConfig); err != nil {
+		return "", fmt.Errorf("failed to parse 'expo config --json' output: %w", err)
+	}
+	return expoConfig.Version, nil
+}
+
+// hasDynamicAppConfig reports whether the project has an app.config.* file
+func hasDynamicAppConfig(rootPath string) bool {
+	for _, name := range appConfigFiles {
+		if _, err := os.Stat(filepath.Join(rootPath, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readVersionFromSource reads the app version from the given version_source
+func readVersionFromSource(rootPath, source string) (version string, from string, err error) {
+	switch source {
+	case versionSourceAppJSON:
+		version, err = readAppJSONVersion(rootPath)
+	case versionSourceAppConfig:
+		version, err = readExpoConfigVersion(rootPath)
+	case versionSourcePackageJSON:
+		var pkg *packageJSON
+		if pkg, err = readPackageJSON(rootPath); err == nil {
+			version = pkg.Version
+		}
+	case versionSourceAuto:
+		candidates := []string{versionSourceAppJSON, versionSourcePackageJSON}
+		if hasDynamicAppConfig(rootPath) {
+			candidates = append([]string{versionSourceAppConfig}, candidates...)
+		}
+		for _, candidate := range candidates {
+			if v, _, err := readVersionFromSource(rootPath, candidate); err == nil && v != "" {
+				return v, candidate, nil
+			}
+		}
+		return "", "", fmt.Errorf("no version found in app.config, app.json or package.json")
+	default:
+		return "", "", fmt.Errorf("unsupported version source '%s' (expected one of %s)", source, strings.Join(versionSources, ", "))
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if version == "" {
+		return "", "", fmt.Errorf("no version set in %s", source)
+	}
+	return version, source, nil
+}
+
+// setJSONVersion rewrites the first "version" string field at or after offset, keeping
+// the rest of the file (key order, indentation) exactly as it was
+func setJSONVersion(data []byte, offset int, version string) ([]byte, bool) {
+	loc := jsonVersionFieldRe.FindSubmatchIndex(data[offset:])
+	if loc == nil {
+		return data, false
+	}
+	start, end, prefixEnd := offset+loc[0], offset+loc[1], offset+loc[3]
+	updated := append([]byte{}, data[:start]...)
+	updated = append(updated, data[start:prefixEnd]...)
+	updated = append(updated, fmt.Sprintf("%q", version)...)
+	return append(updated, data[end:]...), true
+}
+
+// writeAppJSONVersion sets expo.version in app.json; it reports false if app.json has no expo.version
+func writeAppJSONVersion(rootPath, version string, touched *fileSnapshot) (bool, error) {
+	current, err := readAppJSONVersion(rootPath)
+	if err != nil || current == "" {
+		return false, nil // No app.json or no expo.version to keep in sync
+	}
+	path := filepath.Join(rootPath, "app.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read app.json: %w", err)
+	}
+	loc := jsonExpoKeyRe.FindIndex(data)
+	if loc == nil {
+		return false, fmt.Errorf("could not locate the expo section in app.json")
+	}
+	updated, ok := setJSONVersion(data, loc[1], version)
+	if !ok {
+		return false, fmt.Errorf("could not locate expo.version in app.json")
+	}
+	if err := touched.Track(path); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path, updated, 0644); err != nil {
+		return false, fmt.Errorf("failed to write app.json: %w", err)
+	}
+	// A nested "version" key could precede expo.version, so check what we actually changed
+	if got, err := readAppJSONVersion(rootPath); err != nil || got != version {
+		os.WriteFile(path, data, 0644)
+		return false, fmt.Errorf("failed to update expo.version in app.json; file left unchanged")
+	}
+	return true, nil
+}
+
+// writePackageJSONVersion sets version in package.json; it reports false if package.json has no version
+func writePackageJSONVersion(rootPath, version string, touched *fileSnapshot) (bool, error) {
+	pkg, err := readPackageJSON(rootPath)
+	if err != nil || pkg.Version == "" {
+		return false, nil
+	}
+	path := filepath.Join(rootPath, "package.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	updated, ok := setJSONVersion(data, 0, version)
+	if !ok {
+		return false, fmt.Errorf("could not locate version in package.json")
+	}
+	if err := touched.Track(path); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path, updated, 0644); err != nil {
+		return false, fmt.Errorf("failed to write package.json: %w", err)
+	}
+	if pkg, err := readPackageJSON(rootPath); err != nil || pkg.Version != version {
+		os.WriteFile(path, data, 0644)
+		return false, fmt.Errorf("failed to update version in package.json; file left unchanged")
+	}
+	return true, nil
+}
+
+// writeVersionToSources writes version into app.json and package.json (where they declare
+// one) so the JS side (Constants.expoConfig.version) matches the native version. A dynamic
+// app.config.* cannot be rewritten, so it is only checked. touched may be nil.
+func writeVersionToSources(rootPath, version string, touched *fileSnapshot, logOutput io.Writer) error {
+	if ok, err := writeAppJSONVersion(rootPath, version, touched); err != nil {
+		return err
+	} else if ok {
+		fmt.Fprintf(logOutput, "Set expo.version in app.json to %s\n", version)
+	}
+	if ok, err := writePackageJSONVersion(rootPath, version, touched); err != nil {
+		return err
+	} else if ok {
+		fmt.Fprintf(logOutput, "Set version in package.json to %s\n", version)
+	}
+
+	if hasDynamicAppConfig(rootPath) {
+		evaluated, err := readExpoConfigVersion(rootPath)
+		switch {
+		case err != nil:
+			fmt.Fprintf(logOutput, "Warning: could not check the version in app.config: %v\n", err)
+		case evaluated != version:
+			fmt.Fprintf(logOutput, "Warning: app.config evaluates to version %s, not %s; have it read the version from app.json or package.json\n", evaluated, version)
+		}
+	}
+	return nil
+}
+
+// resolveBuildVersion returns the version to build, read from version_source when set,
+// and writes it back to the project's version sources when write_version is enabled
+func resolveBuildVersion(config Config, touched *fileSnapshot, logOutput io.Writer) (string, error) {
+	version := config.BuildVersion
+	if config.VersionSource != "" && config.VersionSource != versionSourceConfig {
+		read, from, err := readVersionFromSource(config.RootPath, config.VersionSource)
+		if err != nil {
+			return "", fmt.Errorf("error reading version: %w", err)
+		}
+		if version != "" && version != read {
+			fmt.Fprintf(logOutput, "Warning: ignoring build_version %s, using %s from %s\n", version, read, from)
+		}
+		fmt.Fprintf(logOutput, "Read version %s from %s\n", read, from)
+		version = read
+	}
+	if version == "" {
+		return "", fmt.Errorf("no build version set")
+	}
+	if !isValidVersion(version) {
+		return "", fmt.Errorf("invalid build version '%s' (expected X.Y.Z or X.Y.Z-rc.N)", version)
+	}
+
+	if config.WriteVersion {
+		if err := writeVersionToSources(config.RootPath, version, touched, logOutput); err != nil {
+			return "", fmt.Errorf("error writing version: %w", err)
+		}
+	}
+	return version, nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultWatchRemote   = "origin"
+	defaultPollSeconds   = 60
+	defaultDebounceSecs  = 120
+	maxBuiltSHAsRemember = 200 // Per branch, in the watch state file
+)
+
+// WatchConfig configures rn-builder watch. The first time a branch is seen (no state
+// yet, or a newly added branch) its current head is recorded as built without building
+// it; only commits pushed after that are built.
+type WatchConfig struct {
+	Remote          string        `yaml:"remote"`           // Remote name, URL or path to poll (default origin)
+	PollSeconds     int           `yaml:"poll_seconds"`     // How often to poll (default 60)
+	DebounceSeconds int           `yaml:"debounce_seconds"` // Build once a branch has not moved for this long (default 120)
+	Branches        []WatchBranch `yaml:"branches"`
+}
+
+// WatchBranch maps a watched branch to the build it triggers
+type WatchBranch struct {
+	Branch   string `yaml:"branch"`
+	Profile  string `yaml:"profile"`  // Optional: profile to build (default: the config watch was started with)
+	Platform string `yaml:"platform"` // Optional: platform override
+}
+
+// watchState is persisted so a restart neither rebuilds nor misses commits
+type watchState struct {
+	Built map[string][]string `json:"built"` // Branch -> SHAs whose build ran (or baselined), oldest first
+}
+
+func (s *watchState) built(branch, sha string) bool {
+	return slices.Contains(s.Built[branch], sha)
+}
+
+func (s *watchState) markBuilt(branch, sha string) {
+	shas := append(s.Built[branch], sha)
+	if len(shas) > maxBuiltSHAsRemember {
+		shas = shas[len(shas)-maxBuiltSHAsRemember:]
+	}
+	s.Built[branch] = shas
+}
+
+// branchWatch tracks a commit waiting for the debounce period to pass
+type branchWatch struct {
+	WatchBranch
+	pending   string // SHA seen but not built yet
+	changedAt time.Time
+	missing   bool // Warned that the branch is not on the remote
+}
+
+// watcher polls the remote and queues builds for new commits
+type watcher struct {
+	root      string
+	remote    string
+	debounce  time.Duration
+	branches  []*branchWatch
+	state     watchState
+	statePath string
+	queue     *BuildQueue
+	resolve   func(BuildRequest) (Config, error)
+	logOutput io.Writer
+}
+
+// runWatchCommand polls for new commits and builds them:
+// rn-builder watch [-config file] [-profiles dir]
+func runWatchCommand(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfig, "Config file with the watch section; also the default profile")
+	profilesDir := fs.String("profiles", "", "Directory with <profile>.yaml config files (default: the config file's directory)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	logDir, err := resolveLogDir(*config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	statePath, err := queueStatePath("watch")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	profiles := newProfileLoader(*configPath, *profilesDir, logDir)
+	queue, err := NewBuildQueue(statePath, config.Queue, profiles.load, &textSink{w: os.Stdout})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(config.Watch.Branches) == 0 && len(config.Schedules) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: nothing to watch: add branches under watch.branches or schedules to the config")
+		return 1
+	}
+	var w *watcher
+	logger := NewRunLogger("", &textSink{w: os.Stdout})
+	logger.SetStep("watch")
+	if len(config.Watch.Branches) > 0 {
+		if w, err = newWatcher(*config, queue, profiles.load, logger); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	scheduleLogger := NewRunLogger("", &textSink{w: os.Stdout})
+	scheduleLogger.SetStep("schedule")
+	stopSchedules, err := startScheduler(*config, queue, profiles.load, scheduleLogger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	queue.Start()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	poll := time.Duration(config.Watch.PollSeconds) * time.Second
+	if poll <= 0 {
+		poll = defaultPollSeconds * time.Second
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	if w != nil {
+		fmt.Fprintf(logger, "Watching %s every %s (builds start after %s without new pushes)\n", w.remote, poll, w.debounce)
+	}
+	for {
+		if w != nil {
+			w.poll(time.Now())
+		}
+		select {
+		case <-ticker.C:
+		case <-interrupts:
+			fmt.Fprintln(os.Stderr, "Stopping watch, cancelling running builds (queued ones are kept)...")
+			stopSchedules()
+			queue.Shutdown()
+			return 0
+		}
+	}
+}
+
+// newWatcher validates the watch config and loads the state of earlier watch sessions
+func newWatcher(config Config, queue *BuildQueue, resolve func(BuildRequest) (Config, error), logOutput io.Writer) (*watcher, error) {
+	wc := config.Watch
+	if len(wc.Branches) == 0 {
+		return nil, errors.New("no branches to watch: add them under watch.branches in the config")
+	}
+	key, err := projectKey(config.RootPath)
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := userDataDir()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		root:      config.RootPath,
+		remote:    wc.Remote,
+		debounce:  time.Duration(wc.DebounceSeconds) * time.Second,
+		statePath: filepath.Join(dataDir, "watch", key+".json"),
+		state:     watchState{Built: make(map[string][]string)},
+		queue:     queue,
+		resolve:   resolve,
+		logOutput: logOutput,
+	}
+	if w.remote == "" {
+		w.remote = defaultWatchRemote
+	}
+	if wc.DebounceSeconds == 0 {
+		w.debounce = defaultDebounceSecs * time.Second
+	}
+	for _, b := range wc.Branches {
+		if b.Branch == "" {
+			return nil, errors.New("watch.branches: every entry needs a branch")
+		}
+		w.branches = append(w.branches, &branchWatch{WatchBranch: b})
+	}
+	data, err := os.ReadFile(w.statePath)
+	if err == nil {
+		if err := json.Unmarshal(data, &w.state); err != nil {
+			return nil, fmt.Errorf("failed to parse watch state %s: %w", w.statePath, err)
+		}
+		if w.state.Built == nil {
+			w.state.Built = make(map[string][]string)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read watch state: %w", err)
+	}
+	return w, nil
+}
+
+// remoteHeads returns the current SHA of each branch on the remote
+func remoteHeads(root, remote string, branches []string) (map[string]string, error) {
+	args := []string{"ls-remote", "--heads", remote}
+	for _, b := range branches {
+		args = append(args, "refs/heads/"+b)
+	}
+	out, err := gitOutput(root, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll %s: %w", remote, err)
+	}
+	heads := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		sha, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if ok {
+			heads[strings.TrimPrefix(ref, "refs/heads/")] = sha
+		}
+	}
+	return heads, nil
+}
+
+// poll checks every branch once and queues the commits whose debounce has passed. A
+// commit counts as built once its job has finished; a job stopped by a shutdown is
+// queued again.
+func (w *watcher) poll(now time.Time) {
+	names := make([]string, 0, len(w.branches))
+	for _, b := range w.branches {
+		names = append(names, b.Branch)
+	}
+	heads, err := remoteHeads(w.root, w.remote, names)
+	if err != nil {
+		fmt.Fprintf(w.logOutput, "Warning: %v\n", err)
+		return
+	}
+
+	jobs := w.queue.Jobs()
+	changed := false
+	for _, b := range w.branches {
+		sha := heads[b.Branch]
+		if sha != "" {
+			b.missing = false
+		}
+		job, hasJob := latestWatchJob(jobs, b.Branch, sha)
+		switch {
+		case sha == "":
+			if !b.missing {
+				fmt.Fprintf(w.logOutput, "Warning: branch %s not found on %s\n", b.Branch, w.remote)
+				b.missing = true
+			}
+		case len(w.state.Built[b.Branch]) == 0:
+			// First sight of the branch: start from its current head rather than build it
+			fmt.Fprintf(w.logOutput, "Watching %s from %.7s\n", b.Branch, sha)
+			w.state.markBuilt(b.Branch, sha)
+			b.pending = ""
+			changed = true
+		case w.state.built(b.Branch, sha):
+			b.pending = "" // Already built, or pushed back to a built commit
+		case hasJob && !job.finished():
+			b.pending = "" // Queued or building
+		case hasJob && !job.Interrupted:
+			fmt.Fprintf(w.logOutput, "Build of %s at %.7s %s (job %s)\n", b.Branch, sha, job.Status, job.ID)
+			w.state.markBuilt(b.Branch, sha)
+			changed = true
+		case sha != b.pending:
+			// New commit; a later push restarts the wait so rapid pushes build once
+			if hasJob {
+				fmt.Fprintf(w.logOutput, "Build of %s at %.7s was interrupted (building again after %s)\n", b.Branch, sha, w.debounce)
+			} else {
+				fmt.Fprintf(w.logOutput, "New commit on %s: %.7s (building after %s without further pushes)\n", b.Branch, sha, w.debounce)
+			}
+			b.pending = sha
+			b.changedAt = now
+		case now.Sub(b.changedAt) >= w.debounce:
+			job, err := w.submit(b, sha)
+			if err != nil {
+				fmt.Fprintf(w.logOutput, "Error: failed to queue %s at %.7s: %v\n", b.Branch, sha, err)
+				continue // Retried on the next poll
+			}
+			fmt.Fprintf(w.logOutput, "Queued build of %s at %.7s (job %s)\n", b.Branch, sha, job.ID)
+			b.pending = ""
+		}
+	}
+	if changed {
+		if err := w.saveState(); err != nil {
+			fmt.Fprintf(w.logOutput, "Warning: %v\n", err)
+		}
+	}
+}
+
+// submit fetches sha from the watched remote into the profile's repository and queues
+// its build
+func (w *watcher) submit(b *branchWatch, sha string) (Job, error) {
+	req := BuildRequest{Profile: b.Profile, Platform: b.Platform, Ref: sha, Branch: b.Branch, Trigger: triggerWatch}
+	config, err := w.resolve(req)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := fetchCommit(config.RootPath, w.remote, b.Branch, sha); err != nil {
+		return Job{}, err
+	}
+	return w.queue.Enqueue(config, req)
+}
+
+// latestWatchJob finds the most recent watch job that built sha of branch
+func latestWatchJob(jobs []Job, branch, sha string) (Job, bool) {
+	var latest Job
+	found := false
+	for _, job := range jobs {
+		r := job.Request
+		if r.Trigger != triggerWatch || r.Branch != branch || r.Ref != sha || sha == "" {
+			continue
+		}
+		if !found || job.SubmittedAt.After(latest.SubmittedAt) {
+			latest, found = job, true
+		}
+	}
+	return latest, found
+}
+
+func (w *watcher) saveState() error {
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode watch state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(w.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create watch state directory: %w", err)
+	}
+	if err := os.WriteFile(w.statePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write watch state: %w", err)
+	}
+	return nil
+}
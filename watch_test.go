@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// watchFixture is a bare repository standing in for the remote, a clone to push from and
+// a builder checkout that does not have the remote as origin, so watched commits must be
+// fetched from the watched remote
+type watchFixture struct {
+	remote, dev, root string
+	config            Config
+	queuePath         string
+}
+
+func newWatchFixture(t *testing.T) *watchFixture {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", "")
+	f := &watchFixture{
+		remote:    filepath.Join(t.TempDir(), "remote.git"),
+		dev:       t.TempDir(),
+		root:      t.TempDir(),
+		queuePath: filepath.Join(t.TempDir(), "queue.json"),
+	}
+	gitRun(t, f.dev, "init", "-q", "--bare", f.remote)
+	gitRun(t, f.dev, "clone", "-q", f.remote, ".")
+	gitRun(t, f.dev, "checkout", "-q", "-b", "main")
+	f.push(t, "initial commit")
+	gitRun(t, f.root, "init", "-q")
+	f.config = Config{RootPath: f.root, BuildVersion: "1.0.0", Platform: "android", LogDir: t.TempDir()}
+	f.config.Watch = WatchConfig{Remote: f.remote, DebounceSeconds: 60, Branches: []WatchBranch{{Branch: "main"}}}
+	return f
+}
+
+// push commits on main and pushes it to the remote, returning the new head
+func (f *watchFixture) push(t *testing.T, message string) string {
+	t.Helper()
+	gitRun(t, f.dev, "commit", "-q", "--allow-empty", "-m", message)
+	gitRun(t, f.dev, "push", "-q", "origin", "main")
+	return strings.TrimSpace(gitRun(t, f.dev, "rev-parse", "HEAD"))
+}
+
+// start creates the queue (restoring its file) and the watcher
+func (f *watchFixture) start(t *testing.T) (*watcher, *BuildQueue) {
+	t.Helper()
+	resolve := func(BuildRequest) (Config, error) { return f.config, nil }
+	queue, err := NewBuildQueue(f.queuePath, QueueLimits{}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(queue.Shutdown)
+	w, err := newWatcher(f.config, queue, resolve, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, queue
+}
+
+func TestWatcherBuildsEachPushOnce(t *testing.T) {
+	f := newWatchFixture(t)
+	w, queue := f.start(t)
+
+	start := time.Now()
+	w.poll(start) // Baseline: the existing head is not built
+	sha := f.push(t, "feat: something to build")
+	w.poll(start.Add(time.Minute)) // Debounce starts
+	w.poll(start.Add(90 * time.Second))
+	if jobs := queue.Jobs(); len(jobs) != 0 {
+		t.Fatalf("queued %d jobs before the debounce passed", len(jobs))
+	}
+	w.poll(start.Add(2 * time.Minute))
+	jobs := queue.Jobs()
+	if len(jobs) != 1 || jobs[0].Request.Ref != sha || jobs[0].Request.Trigger != triggerWatch {
+		t.Fatalf("jobs = %+v, want one watch build of %s", jobs, sha)
+	}
+	if _, err := gitOutput(f.root, "cat-file", "-e", sha+"^{commit}"); err != nil {
+		t.Errorf("commit was not fetched from the watched remote: %v", err)
+	}
+
+	// Later polls neither queue the commit again nor mark it built while the job waits
+	w.poll(start.Add(5 * time.Minute))
+	if len(queue.Jobs()) != 1 || w.state.built("main", sha) {
+		t.Fatalf("second poll: %d jobs, built = %v", len(queue.Jobs()), w.state.built("main", sha))
+	}
+
+	// Once the job has run (the checkout has no app, so the build fails) the commit is built
+	queue.Start()
+	waitForJob(t, queue, jobs[0].ID)
+	w.poll(start.Add(10 * time.Minute))
+	w.poll(start.Add(20 * time.Minute))
+	if len(queue.Jobs()) != 1 {
+		t.Errorf("the same commit was built %d times", len(queue.Jobs()))
+	}
+	if !w.state.built("main", sha) {
+		t.Error("commit not marked built after its job ran")
+	}
+	if _, err := os.Stat(w.statePath); err != nil {
+		t.Errorf("watch state not saved: %v", err)
+	}
+}
+
+func TestWatcherRequeuesInterruptedJobs(t *testing.T) {
+	f := newWatchFixture(t)
+	w, queue := f.start(t)
+	start := time.Now()
+	w.poll(start)
+	sha := f.push(t, "fix: interrupted")
+	queue.Shutdown()
+
+	// The previous watch session stopped while the commit was building
+	job := Job{
+		ID:          "20240501-101500-abcdef",
+		Request:     BuildRequest{Ref: sha, Branch: "main", Trigger: triggerWatch},
+		Workspace:   f.root,
+		Platforms:   []string{"android"},
+		Status:      jobStatusRunning,
+		SubmittedAt: start,
+	}
+	data, _ := json.Marshal([]persistedJob{{Job: job, Config: f.config}})
+	if err := os.WriteFile(f.queuePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, queue = f.start(t)
+	w.poll(start.Add(time.Minute))
+	w.poll(start.Add(2 * time.Minute))
+	if w.state.built("main", sha) {
+		t.Error("interrupted build counted as built")
+	}
+	jobs := queue.Jobs()
+	if len(jobs) != 2 || !jobs[0].Interrupted || jobs[1].Request.Ref != sha || jobs[1].Status != jobStatusQueued {
+		t.Errorf("jobs = %+v, want the interrupted job and a new one for %s", jobs, sha)
+	}
+}
+
+// waitForJob waits until a job has finished
+func waitForJob(t *testing.T, queue *BuildQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := queue.Job(id); ok && job.finished() {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// What to do when the project has uncommitted changes (dirty_tree)
+const (
+	dirtyTreeWarn   = "warn"   // Log the changed files and build anyway (default)
+	dirtyTreeRefuse = "refuse" // Fail the build before touching anything
+	dirtyTreeIgnore = "ignore" // Do not check
+)
+
+// gitDirtyFiles lists tracked files with uncommitted changes (untracked files are ignored)
+func gitDirtyFiles(rootPath string) ([]string, error) {
+	// -z keeps paths unquoted and NUL-separated; git's warnings stay on stderr
+	cmd := exec.Command("git", "status", "--porcelain", "-z", "--untracked-files=no")
+	cmd.Dir = rootPath
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to get git status: %w - output: %s", err, string(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("failed to get git status: %w", err)
+	}
+	return parsePorcelainZ(string(output)), nil
+}
+
+// parsePorcelainZ returns the paths in `git status --porcelain -z` output. Each entry is
+// "XY path"; renames and copies are followed by an extra entry with the original path.
+func parsePorcelainZ(output string) []string {
+	var files []string
+	entries := strings.Split(output, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		files = append(files, entry[3:])
+		if entry[0] == 'R' || entry[0] == 'C' || entry[1] == 'R' || entry[1] == 'C' {
+			i++ // Skip the original path
+		}
+	}
+	return files
+}
+
+// checkWorkingTree applies the dirty_tree policy before the build edits any files
+func checkWorkingTree(config Config, logOutput io.Writer) error {
+	policy := strings.ToLower(config.DirtyTree)
+	switch policy {
+	case "":
+		policy = dirtyTreeWarn
+	case dirtyTreeWarn, dirtyTreeRefuse:
+	case dirtyTreeIgnore:
+		return nil
+	default:
+		return fmt.Errorf("unsupported dirty_tree setting '%s' (expected warn, refuse or ignore)", config.DirtyTree)
+	}
+
+	files, err := gitDirtyFiles(config.RootPath)
+	if err != nil {
+		if policy == dirtyTreeRefuse {
+			// Fail closed: refuse means the tree must be known to be clean
+			return fmt.Errorf("could not check for uncommitted changes (dirty_tree: refuse): %w", err)
+		}
+		fmt.Fprintf(logOutput, "Warning: could not check for uncommitted changes: %v\n", err)
+		return nil
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(logOutput, "Working tree is clean.")
+		return nil
+	}
+	list := strings.Join(files, ", ")
+	if policy == dirtyTreeRefuse {
+		return fmt.Errorf("working tree has uncommitted changes (%s); commit or stash them, or set dirty_tree: warn", list)
+	}
+	fmt.Fprintf(logOutput, "Warning: building with uncommitted changes: %s\n", list)
+	return nil
+}
+
+// fileSnapshot remembers the original contents of files the build edits in place, so
+// they can be put back when the build ends (succeeded, failed or cancelled)
+type fileSnapshot struct {
+	mu    sync.Mutex
+	files map[string]*snapshotEntry
+	order []string
+}
+
+type snapshotEntry struct {
+	data    []byte
+	mode    os.FileMode
+	existed bool
+}
+
+func newFileSnapshot() *fileSnapshot {
+	return &fileSnapshot{files: make(map[string]*snapshotEntry)}
+}
+
+// Track records path's current contents; call it before modifying the file. Only the
+// first call for a path counts, so the original is what gets restored.
+func (s *fileSnapshot) Track(path string) error {
+	if s == nil {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[abs]; ok {
+		return nil
+	}
+
+	entry := &snapshotEntry{}
+	info, err := os.Stat(abs)
+	switch {
+	case err == nil:
+		if entry.data, err = os.ReadFile(abs); err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", path, err)
+		}
+		entry.mode = info.Mode().Perm()
+		entry.existed = true
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to snapshot %s: %w", path, err)
+	}
+	s.files[abs] = entry
+	s.order = append(s.order, abs)
+	return nil
+}
+
+// Restore writes every tracked file back to its original contents (removing files that
+// did not exist) and reports the ones that could not be restored
+func (s *fileSnapshot) Restore(logOutput io.Writer) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, path := range s.order {
+		entry := s.files[path]
+		var err error
+		if entry.existed {
+			err = os.WriteFile(path, entry.data, entry.mode)
+		} else if err = os.Remove(path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", path, err))
+			continue
+		}
+		fmt.Fprintf(logOutput, "Restored %s\n", path)
+	}
+	s.files = make(map[string]*snapshotEntry)
+	s.order = nil
+	return errors.Join(errs...)
+}
+
+// resolveGitRef resolves a branch, tag or SHA to a commit, fetching from origin when the
+// ref is not known locally (e.g. a branch that only exists on the remote)
+func resolveGitRef(rootPath, ref string, logOutput io.Writer) (string, error) {
+	revParse := func(name string) (string, error) {
+		cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", name+"^{commit}")
+		cmd.Dir = rootPath
+		output, err := cmd.Output()
+		return strings.TrimSpace(string(output)), err
+	}
+	if sha, err := revParse(ref); err == nil {
+		return sha, nil
+	}
+
+	fmt.Fprintf(logOutput, "Ref '%s' not found locally, fetching from origin...\n", ref)
+	cmd := exec.Command("git", "fetch", "--tags", "origin")
+	cmd.Dir = rootPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git ref '%s' not found locally and git fetch failed: %w - output: %s", ref, err, string(output))
+	}
+	for _, name := range []string{ref, "origin/" + ref} {
+		if sha, err := revParse(name); err == nil {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("git ref '%s' not found (not a branch, tag or commit in %s or origin)", ref, rootPath)
+}
+
+// fetchCommit makes sha available in rootPath by fetching branch from remote, which may
+// be a remote name, URL or path other than origin. Builds of sha then resolve it locally.
+func fetchCommit(rootPath, remote, branch, sha string) error {
+	hasCommit := func() bool {
+		_, err := gitOutput(rootPath, "cat-file", "-e", sha+"^{commit}")
+		return err == nil
+	}
+	if hasCommit() {
+		return nil
+	}
+	if _, err := gitOutput(rootPath, "fetch", "--no-tags", remote, "refs/heads/"+branch); err != nil {
+		return fmt.Errorf("failed to fetch %s from %s: %w", branch, remote, err)
+	}
+	if hasCommit() {
+		return nil
+	}
+	// The branch was force-pushed past sha since it was polled; ask for the commit itself
+	if _, err := gitOutput(rootPath, "fetch", "--no-tags", remote, sha); err != nil {
+		return fmt.Errorf("failed to fetch %.7s from %s: %w", sha, remote, err)
+	}
+	return nil
+}
+
+// refBranchName returns the branch name a ref stands for (origin/staging -> staging);
+// tags and SHAs are returned unchanged
+func refBranchName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/origin/", "origin/"} {
+		if name, ok := strings.CutPrefix(ref, prefix); ok {
+			return name
+		}
+	}
+	return ref
+}
+
+// gitWorktree is a temporary detached checkout of one commit, outside the developer's checkout
+type gitWorktree struct {
+	repoPath string
+	Path     string
+}
+
+// removeGitWorktree removes a worktree directory and its registration in the repository
+func removeGitWorktree(repoPath, path string) error {
+	cmd := exec.Command("git", "worktree", "remove", "--force", path)
+	cmd.Dir = repoPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		// Not (or no longer) registered; make sure the directory itself is gone
+		if rmErr := os.RemoveAll(path); rmErr != nil {
+			return fmt.Errorf("git worktree remove failed: %w - output: %s", err, string(output))
+		}
+	}
+	prune := exec.Command("git", "worktree", "prune")
+	prune.Dir = repoPath
+	prune.Run()
+	return nil
+}
+
+// createGitWorktree checks out commit into a temporary worktree under the user data dir.
+// Every run gets its own directory, so builds of the same ref in the GUI, serve and
+// watch never share (or remove) each other's checkout.
+func createGitWorktree(rootPath, ref, commit string, logOutput io.Writer) (*gitWorktree, error) {
+	dataDir, err := userDataDir()
+	if err != nil {
+		return nil, err
+	}
+	key, err := projectKey(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Join(dataDir, "worktrees", key)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+	safeRef := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(ref)
+	path, err := os.MkdirTemp(parent, safeRef+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+
+	fmt.Fprintf(logOutput, "Creating worktree for %s (%s) at %s\n", ref, commit, path)
+	cmd := exec.Command("git", "worktree", "add", "--detach", path, commit)
+	cmd.Dir = rootPath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("git worktree add failed: %w - output: %s", err, string(output))
+	}
+	wt := &gitWorktree{repoPath: rootPath, Path: path}
+
+	if _, err := os.Stat(filepath.Join(path, ".gitmodules")); err == nil {
+		fmt.Fprintln(logOutput, "Initializing submodules in worktree...")
+		cmd := exec.Command("git", "submodule", "update", "--init", "--recursive")
+		cmd.Dir = path
+		if output, err := cmd.CombinedOutput(); err != nil {
+			wt.Remove()
+			return nil, fmt.Errorf("git submodule update failed: %w - output: %s", err, string(output))
+		}
+	}
+	return wt, nil
+}
+
+// Remove deletes the worktree; the developer's checkout is never touched
+func (wt *gitWorktree) Remove() error {
+	return removeGitWorktree(wt.repoPath, wt.Path)
+}
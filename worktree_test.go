@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// gitRun runs git in dir with a fixed identity, failing the test on error
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return string(output)
+}
+
+func TestParsePorcelainZ(t *testing.T) {
+	output := " M app.json\x00R  new name.js\x00old name.js\x00MM \"quoted\".txt\x00"
+	got := parsePorcelainZ(output)
+	want := []string{"app.json", "new name.js", `"quoted".txt`}
+	if !slices.Equal(got, want) {
+		t.Errorf("parsePorcelainZ = %q, want %q", got, want)
+	}
+}
+
+func TestGitDirtyFiles(t *testing.T) {
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q")
+	for _, name := range []string{"app.json", "old.js", "ünïcode file.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("v1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitRun(t, dir, "add", ".")
+	gitRun(t, dir, "commit", "-q", "-m", "init")
+
+	os.WriteFile(filepath.Join(dir, "ünïcode file.txt"), []byte("v2\n"), 0644)
+	gitRun(t, dir, "mv", "old.js", "new.js")
+	os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("x\n"), 0644)
+
+	got, err := gitDirtyFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	want := []string{"new.js", "ünïcode file.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("gitDirtyFiles = %q, want %q", got, want)
+	}
+}
+
+func TestCheckWorkingTree(t *testing.T) {
+	notRepo := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(notRepo))
+	dirty := t.TempDir()
+	gitRun(t, dirty, "init", "-q")
+	os.WriteFile(filepath.Join(dirty, "app.json"), []byte("v1\n"), 0644)
+	gitRun(t, dirty, "add", ".")
+	gitRun(t, dirty, "commit", "-q", "-m", "init")
+	os.WriteFile(filepath.Join(dirty, "app.json"), []byte("v2\n"), 0644)
+
+	tests := []struct {
+		name, root, policy string
+		wantErr            bool
+	}{
+		{"dirty tree warns", dirty, "", false},
+		{"dirty tree refused", dirty, dirtyTreeRefuse, true},
+		{"dirty tree ignored", dirty, dirtyTreeIgnore, false},
+		{"status failure warns", notRepo, dirtyTreeWarn, false},
+		{"status failure refused", notRepo, dirtyTreeRefuse, true},
+		{"status failure ignored", notRepo, dirtyTreeIgnore, false},
+		{"unknown policy", dirty, "maybe", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWorkingTree(Config{RootPath: tt.root, DirtyTree: tt.policy}, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkWorkingTree = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateGitWorktreePerRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", "")
+	repo := t.TempDir()
+	gitRun(t, repo, "init", "-q")
+	gitRun(t, repo, "commit", "-q", "--allow-empty", "-m", "init")
+	commit := strings.TrimSpace(gitRun(t, repo, "rev-parse", "HEAD"))
+
+	first, err := createGitWorktree(repo, "main", commit, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := createGitWorktree(repo, "main", commit, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Path == second.Path {
+		t.Fatalf("both runs got worktree %s", first.Path)
+	}
+	if _, err := os.Stat(filepath.Join(first.Path, ".git")); err != nil {
+		t.Errorf("first worktree was removed by the second run: %v", err)
+	}
+	for _, wt := range []*gitWorktree{first, second} {
+		if err := wt.Remove(); err != nil {
+			t.Error(err)
+		}
+	}
+}